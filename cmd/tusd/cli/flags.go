@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +19,15 @@ var Flags struct {
 	HttpPort                string
 	HttpSock                string
 	MaxSize                 int64
+	MaxChunkSize            int64
+	DisableTermination      bool
+	MaxUploadDuration       time.Duration
+	IdempotencyKeyWindow    time.Duration
+	CreationRateLimit       float64
+	CreationRateBurst       int
+	CreationRateLimitExempt string
+	DetectFiletype          bool
+	OverrideFiletype        bool
 	UploadDir               string
 	Basepath                string
 	ShowGreeting            bool
@@ -50,6 +60,10 @@ var Flags struct {
 	ShowVersion             bool
 	ExposeMetrics           bool
 	MetricsPath             string
+	ChunkSizeBucketsString  string
+	ChunkSizeBuckets        []float64
+	DurationBucketsString   string
+	DurationBuckets         []float64
 	BehindProxy             bool
 	VerboseOutput           bool
 	S3TransferAcceleration  bool
@@ -65,6 +79,15 @@ func ParseFlags() {
 	flag.StringVar(&Flags.HttpPort, "port", "1080", "Port to bind HTTP server to")
 	flag.StringVar(&Flags.HttpSock, "unix-sock", "", "If set, will listen to a UNIX socket at this location instead of a TCP socket")
 	flag.Int64Var(&Flags.MaxSize, "max-size", 0, "Maximum size of a single upload in bytes")
+	flag.Int64Var(&Flags.MaxChunkSize, "max-chunk-size", 0, "Maximum number of bytes accepted from a single request's body before it is cut off")
+	flag.BoolVar(&Flags.DisableTermination, "disable-termination", false, "Disallow the termination of uploads using DELETE requests")
+	flag.DurationVar(&Flags.MaxUploadDuration, "max-upload-duration", 0, "Maximum duration after an upload's creation within which it must be completed, e.g. 24h. A zero value means that uploads have no deadline")
+	flag.DurationVar(&Flags.IdempotencyKeyWindow, "idempotency-key-window", 0, "Duration for which Idempotency-Key headers of creation requests are remembered to deduplicate retries, e.g. 1h. A zero value disables the deduplication")
+	flag.Float64Var(&Flags.CreationRateLimit, "creation-rate-limit", 0, "Number of uploads each client may create per second, e.g. 0.5. A zero value disables the rate limit")
+	flag.IntVar(&Flags.CreationRateBurst, "creation-rate-burst", 1, "Number of uploads each client may create at once before the rate limit applies")
+	flag.StringVar(&Flags.CreationRateLimitExempt, "creation-rate-limit-exempt", "", "Comma separated list of IP addresses and CIDR ranges of clients which are not rate limited")
+	flag.BoolVar(&Flags.DetectFiletype, "detect-filetype", false, "Detect the file type from the first bytes of an upload and record it in the detected-filetype metadata (only supported by the local disk storage)")
+	flag.BoolVar(&Flags.OverrideFiletype, "override-filetype", false, "Use the detected file type instead of the client-supplied filetype for downloads (requires -detect-filetype)")
 	flag.StringVar(&Flags.UploadDir, "upload-dir", "./data", "Directory to store uploads in")
 	flag.StringVar(&Flags.Basepath, "base-path", "/files/", "Basepath of the HTTP server")
 	flag.BoolVar(&Flags.ShowGreeting, "show-greeting", true, "Show the greeting message")
@@ -96,6 +119,8 @@ func ParseFlags() {
 	flag.BoolVar(&Flags.ShowVersion, "version", false, "Print tusd version information")
 	flag.BoolVar(&Flags.ExposeMetrics, "expose-metrics", true, "Expose metrics about tusd usage")
 	flag.StringVar(&Flags.MetricsPath, "metrics-path", "/metrics", "Path under which the metrics endpoint will be accessible")
+	flag.StringVar(&Flags.ChunkSizeBucketsString, "metrics-chunk-size-buckets", "", "Comma separated list of the upper bounds in bytes of the buckets of the PATCH chunk size histogram (e.g. 65536,1048576,16777216). Leave empty to use the default buckets")
+	flag.StringVar(&Flags.DurationBucketsString, "metrics-patch-duration-buckets", "", "Comma separated list of the upper bounds in seconds of the buckets of the PATCH duration histogram (e.g. 0.1,1,10,60). Leave empty to use the default buckets")
 	flag.BoolVar(&Flags.BehindProxy, "behind-proxy", false, "Respect X-Forwarded-* and similar headers which may be set by proxies")
 	flag.BoolVar(&Flags.VerboseOutput, "verbose", true, "Enable verbose logging output")
 	flag.BoolVar(&Flags.S3TransferAcceleration, "s3-transfer-acceleration", false, "Use AWS S3 transfer acceleration endpoint (requires -s3-bucket option and Transfer Acceleration property on S3 bucket to be set)")
@@ -107,6 +132,8 @@ func ParseFlags() {
 	flag.Parse()
 
 	SetEnabledHooks()
+	Flags.ChunkSizeBuckets = parseBuckets("metrics-chunk-size-buckets", Flags.ChunkSizeBucketsString)
+	Flags.DurationBuckets = parseBuckets("metrics-patch-duration-buckets", Flags.DurationBucketsString)
 
 	if Flags.FileHooksDir != "" {
 		Flags.FileHooksDir, _ = filepath.Abs(Flags.FileHooksDir)
@@ -146,3 +173,22 @@ func SetEnabledHooks() {
 		Flags.EnabledHooks = hooks.AvailableHooks
 	}
 }
+
+// parseBuckets parses the comma separated upper bounds of histogram buckets
+// passed using the named flag.
+func parseBuckets(name string, value string) []float64 {
+	if value == "" {
+		return nil
+	}
+
+	var buckets []float64
+	for _, bound := range strings.Split(value, ",") {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(bound), 64)
+		if err != nil {
+			stderr.Fatalf("Invalid bucket in -%s flag: %s", name, bound)
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets
+}
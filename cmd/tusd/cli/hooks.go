@@ -35,8 +35,8 @@ func hookCallback(typ hooks.HookType, info handler.HookEvent) error {
 	return nil
 }
 
-func preCreateCallback(info handler.HookEvent) error {
-	return hookCallback(hooks.HookPreCreate, info)
+func preCreateCallback(info handler.HookEvent) (handler.FileInfoChanges, error) {
+	return handler.FileInfoChanges{}, hookCallback(hooks.HookPreCreate, info)
 }
 
 func preFinishCallback(info handler.HookEvent) error {
@@ -25,6 +25,16 @@ const (
 func Serve() {
 	config := handler.Config{
 		MaxSize:                 Flags.MaxSize,
+		MaxChunkSize:            Flags.MaxChunkSize,
+		DisableTermination:      Flags.DisableTermination,
+		MaxUploadDuration:       Flags.MaxUploadDuration,
+		IdempotencyKeyWindow:    Flags.IdempotencyKeyWindow,
+		CreationRateLimit:       Flags.CreationRateLimit,
+		CreationRateBurst:       Flags.CreationRateBurst,
+		ChunkSizeBuckets:        Flags.ChunkSizeBuckets,
+		PatchDurationBuckets:    Flags.DurationBuckets,
+		DetectFiletype:          Flags.DetectFiletype,
+		OverrideFiletype:        Flags.OverrideFiletype,
 		BasePath:                Flags.Basepath,
 		RespectForwardedHeaders: Flags.BehindProxy,
 		StoreComposer:           Composer,
@@ -34,6 +44,10 @@ func Serve() {
 		NotifyCreatedUploads:    true,
 	}
 
+	if Flags.CreationRateLimitExempt != "" {
+		config.CreationRateLimitExempt = strings.Split(Flags.CreationRateLimitExempt, ",")
+	}
+
 	if err := SetupPreHooks(&config); err != nil {
 		stderr.Fatalf("Unable to setup hooks for handler: %s", err)
 	}
@@ -16,6 +16,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/tus/tusd/internal/uid"
 	"github.com/tus/tusd/pkg/handler"
@@ -46,6 +49,11 @@ func (store FileStore) UseIn(composer *handler.StoreComposer) {
 	composer.UseTerminater(store)
 	composer.UseConcater(store)
 	composer.UseLengthDeferrer(store)
+	composer.UseTruncater(store)
+	composer.UseHolder(store)
+	composer.UseLister(store)
+	composer.UseMetaDataUpdater(store)
+	composer.UseReleaser(store)
 }
 
 func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
@@ -56,6 +64,8 @@ func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (ha
 		"Type": "filestore",
 		"Path": binPath,
 	}
+	createdAt := time.Now().UTC()
+	info.CreatedAt = &createdAt
 
 	// Create binary file with no content
 	file, err := os.OpenFile(binPath, os.O_CREATE|os.O_WRONLY, defaultFilePerm)
@@ -131,6 +141,91 @@ func (store FileStore) AsConcatableUpload(upload handler.Upload) handler.Concata
 	return upload.(*fileUpload)
 }
 
+func (store FileStore) AsTruncatableUpload(upload handler.Upload) handler.TruncatableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) AsHoldableUpload(upload handler.Upload) handler.HoldableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) AsMetaDataUpdatableUpload(upload handler.Upload) handler.MetaDataUpdatableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) WithholdUpload(ctx context.Context, id string) error {
+	return store.setReleased(ctx, id, false)
+}
+
+func (store FileStore) ReleaseUpload(ctx context.Context, id string) error {
+	return store.setReleased(ctx, id, true)
+}
+
+// setReleased persists the upload's release state in its .info file.
+func (store FileStore) setReleased(ctx context.Context, id string, released bool) error {
+	upload, err := store.GetUpload(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return upload.(*fileUpload).updateInfo(func(info *handler.FileInfo) {
+		info.Unreleased = !released
+	})
+}
+
+// ListUploads reads the names of all files in the directory, but only the
+// information about the returned uploads. Since the directory has no order
+// to resume from, every call reads all names again, so listing N uploads
+// page by page reads the directory N/limit times. The handler caps the
+// number of pages per request using Config.AdminListScanLimit.
+func (store FileStore) ListUploads(ctx context.Context, after string, limit int) ([]handler.FileInfo, error) {
+	dir, err := os.Open(store.Path)
+	if err != nil {
+		return nil, err
+	}
+	// Only the names are needed, which saves a stat call per file compared
+	// to ioutil.ReadDir.
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// The IDs are sorted explicitly as the order of the file names may differ
+	// due to the .info suffix.
+	ids := make([]string, 0, len(names)/2)
+	for _, name := range names {
+		if id := strings.TrimSuffix(name, ".info"); id != name && id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	infos := make([]handler.FileInfo, 0, limit)
+	for _, id := range ids {
+		if len(infos) == limit {
+			break
+		}
+
+		upload, err := store.GetUpload(ctx, id)
+		if err == handler.ErrNotFound {
+			// The upload has been terminated in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := upload.GetInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
 // binPath returns the path to the file storing the binary data.
 func (store FileStore) binPath(id string) string {
 	return filepath.Join(store.Path, id)
@@ -181,6 +276,27 @@ func (upload *fileUpload) Terminate(ctx context.Context) error {
 	return nil
 }
 
+func (upload *fileUpload) Truncate(ctx context.Context, offset int64) error {
+	if err := os.Truncate(upload.binPath, offset); err != nil {
+		return err
+	}
+
+	upload.info.Offset = offset
+	return nil
+}
+
+func (upload *fileUpload) SetOnHold(ctx context.Context, onHold bool) error {
+	return upload.updateInfo(func(info *handler.FileInfo) {
+		info.OnHold = onHold
+	})
+}
+
+func (upload *fileUpload) SetMetaData(ctx context.Context, meta handler.MetaData) error {
+	return upload.updateInfo(func(info *handler.FileInfo) {
+		info.MetaData = meta
+	})
+}
+
 func (upload *fileUpload) ConcatUploads(ctx context.Context, uploads []handler.Upload) (err error) {
 	file, err := os.OpenFile(upload.binPath, os.O_WRONLY|os.O_APPEND, defaultFilePerm)
 	if err != nil {
@@ -205,8 +321,36 @@ func (upload *fileUpload) ConcatUploads(ctx context.Context, uploads []handler.U
 }
 
 func (upload *fileUpload) DeclareLength(ctx context.Context, length int64) error {
-	upload.info.Size = length
-	upload.info.SizeIsDeferred = false
+	return upload.updateInfo(func(info *handler.FileInfo) {
+		info.Size = length
+		info.SizeIsDeferred = false
+	})
+}
+
+// updateInfo changes a single aspect of the information. The .info file is
+// read again beforehand, so that changes made in the meantime using another
+// fileUpload for the same upload, e.g. putting it on hold while a chunk is
+// written, are not overwritten by this upload's outdated copy.
+func (upload *fileUpload) updateInfo(change func(info *handler.FileInfo)) error {
+	data, err := ioutil.ReadFile(upload.infoPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Interpret os.ErrNotExist as 404 Not Found
+			err = handler.ErrNotFound
+		}
+		return err
+	}
+
+	info := handler.FileInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
+
+	// The offset is derived from the binary file instead
+	info.Offset = upload.info.Offset
+	change(&info)
+	upload.info = info
+
 	return upload.writeInfo()
 }
 
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
@@ -17,6 +18,11 @@ var _ handler.DataStore = FileStore{}
 var _ handler.TerminaterDataStore = FileStore{}
 var _ handler.ConcaterDataStore = FileStore{}
 var _ handler.LengthDeferrerDataStore = FileStore{}
+var _ handler.TruncaterDataStore = FileStore{}
+var _ handler.HolderDataStore = FileStore{}
+var _ handler.ListerDataStore = FileStore{}
+var _ handler.MetaDataUpdaterDataStore = FileStore{}
+var _ handler.ReleaserDataStore = FileStore{}
 
 func TestFilestore(t *testing.T) {
 	a := assert.New(t)
@@ -46,6 +52,7 @@ func TestFilestore(t *testing.T) {
 	a.Equal(2, len(info.Storage))
 	a.Equal("filestore", info.Storage["Type"])
 	a.Equal(filepath.Join(tmp, info.ID), info.Storage["Path"])
+	a.NotNil(info.CreatedAt)
 
 	// Write data to upload
 	bytesWritten, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
@@ -76,6 +83,191 @@ func TestFilestore(t *testing.T) {
 	a.Equal(handler.ErrNotFound, err)
 }
 
+func TestTruncate(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{Size: 11})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	a.NoError(store.AsTruncatableUpload(upload).Truncate(ctx, 5))
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(5, info.Offset)
+
+	// The offset is also derived from the file when reading the upload again
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(5, info.Offset)
+
+	_, err = upload.WriteChunk(ctx, 5, strings.NewReader("!"))
+	a.NoError(err)
+
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+	content, err := ioutil.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("hello!", string(content))
+	reader.(io.Closer).Close()
+}
+
+func TestSetOnHold(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{Size: 11})
+	a.NoError(err)
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	a.NoError(store.AsHoldableUpload(upload).SetOnHold(ctx, true))
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.True(info.OnHold)
+
+	a.NoError(store.AsHoldableUpload(upload).SetOnHold(ctx, false))
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.OnHold)
+}
+
+func TestSetMetaData(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+		MetaData: handler.MetaData{
+			"filetype": "text/plain",
+		},
+	})
+	a.NoError(err)
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	meta := handler.MetaData{
+		"filetype":          "text/plain",
+		"detected-filetype": "image/png",
+	}
+	a.NoError(store.AsMetaDataUpdatableUpload(upload).SetMetaData(ctx, meta))
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(meta, info.MetaData)
+
+	// Changes made using another value for the same upload are kept, even if
+	// this one's copy of the info is outdated
+	held, err := store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	a.NoError(store.AsHoldableUpload(held).SetOnHold(ctx, true))
+	a.NoError(store.AsMetaDataUpdatableUpload(upload).SetMetaData(ctx, handler.MetaData{}))
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.True(info.OnHold)
+	a.Equal(handler.MetaData{}, info.MetaData)
+}
+
+func TestReleaseUpload(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{Size: 11})
+	a.NoError(err)
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.Unreleased)
+
+	a.NoError(store.WithholdUpload(ctx, info.ID))
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.True(info.Unreleased)
+
+	a.NoError(store.ReleaseUpload(ctx, info.ID))
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.Unreleased)
+
+	a.Equal(handler.ErrNotFound, store.ReleaseUpload(ctx, "no"))
+}
+
+func TestListUploads(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := ioutil.TempDir("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := FileStore{tmp}
+	ctx := context.Background()
+
+	ids := make([]string, 5)
+	for i := range ids {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{Size: 11})
+		a.NoError(err)
+		info, err := upload.GetInfo(ctx)
+		a.NoError(err)
+		ids[i] = info.ID
+	}
+	sort.Strings(ids)
+
+	infos, err := store.ListUploads(ctx, "", 3)
+	a.NoError(err)
+	a.Len(infos, 3)
+	a.Equal(ids[0], infos[0].ID)
+	a.Equal(ids[2], infos[2].ID)
+	a.EqualValues(11, infos[0].Size)
+
+	infos, err = store.ListUploads(ctx, ids[2], 3)
+	a.NoError(err)
+	a.Len(infos, 2)
+	a.Equal(ids[3], infos[0].ID)
+	a.Equal(ids[4], infos[1].ID)
+
+	infos, err = store.ListUploads(ctx, ids[4], 3)
+	a.NoError(err)
+	a.Len(infos, 0)
+}
+
 func TestMissingPath(t *testing.T) {
 	a := assert.New(t)
 
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reAdminPath = regexp.MustCompile(`(^|/)admin/uploads(/[^/]+(/hold|/release)?)?/?$`)
+
+// redactedValue replaces the values of sensitive metadata keys in responses
+// of the admin endpoint.
+const redactedValue = "[REDACTED]"
+
+// adminUpload is the body of responses of the admin endpoint. It contains the
+// upload's FileInfo, as reported by the data store, and its expiry.
+type adminUpload struct {
+	FileInfo
+	// ExpiresAt is only set if the data store supports the Expiration extension
+	// and the upload expires.
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+// AdminGetUpload responds with the upload's FileInfo, as reported by the data
+// store, encoded as JSON. It is intended for inspecting uploads for support and
+// debugging purposes. The values of the SensitiveMetadataKeys and
+// SensitiveStorageKeys are redacted.
+// The request is only handled if AdminAuthorizeCallback is configured and
+// accepts it, otherwise it is answered with 404 Not Found as if the endpoint
+// did not exist.
+func (handler *UnroutedHandler) AdminGetUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := newStoreContext(r)
+
+	if err := handler.authorizeAdminRequest(r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	id, err := extractIDFromPath(r.URL.Path)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	body := adminUpload{
+		FileInfo: info,
+	}
+	body.MetaData = handler.redactMetadata(info.MetaData)
+	body.Storage = redactValues(info.Storage, handler.config.SensitiveStorageKeys)
+
+	if handler.composer.UsesExpirer {
+		expiresAt, err := handler.composer.Expirer.AsExpirableUpload(upload).ExpiresAt(ctx)
+		if err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+		if !expiresAt.IsZero() {
+			body.ExpiresAt = &expiresAt
+		}
+	}
+
+	result, err := json.Marshal(body)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(result)))
+	w.Header().Set("Cache-Control", "no-store")
+	handler.sendResp(w, r, http.StatusOK)
+	w.Write(result)
+}
+
+// AdminHoldUpload puts the upload on hold, so that PATCH requests for it are
+// rejected with HeldUploadStatusCode until it is released again using
+// AdminReleaseUpload. The data received so far is kept and HEAD requests
+// continue to work, so clients can poll the upload's state. The request locks
+// the upload like other requests, so it is not applied while a PATCH request
+// is in progress, but waits for it if UploadQueueTimeout is set or is rejected
+// otherwise. The same authorization as for AdminGetUpload applies.
+func (handler *UnroutedHandler) AdminHoldUpload(w http.ResponseWriter, r *http.Request) {
+	handler.setUploadOnHold(w, r, true)
+}
+
+// AdminReleaseUpload releases an upload put on hold using AdminHoldUpload, so
+// that it can be resumed.
+func (handler *UnroutedHandler) AdminReleaseUpload(w http.ResponseWriter, r *http.Request) {
+	handler.setUploadOnHold(w, r, false)
+}
+
+func (handler *UnroutedHandler) setUploadOnHold(w http.ResponseWriter, r *http.Request, onHold bool) {
+	ctx := newStoreContext(r)
+
+	if err := handler.authorizeAdminRequest(r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if !handler.composer.UsesHolder {
+		handler.sendError(w, r, ErrNotImplemented)
+		return
+	}
+
+	id, err := extractIDFromPath(strings.TrimSuffix(r.URL.Path, "/hold"))
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if handler.locksUploads() {
+		lock, err := handler.lockUpload(id)
+		if err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+
+		defer lock.Unlock()
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	holdableUpload := handler.composer.Holder.AsHoldableUpload(upload)
+	if err := holdableUpload.SetOnHold(ctx, onHold); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if onHold {
+		handler.log("UploadHeld", "id", id)
+	} else {
+		handler.log("UploadReleased", "id", id)
+	}
+
+	handler.sendResp(w, r, http.StatusNoContent)
+}
+
+// AdminReleaseDownload releases a finished upload which has been withheld from
+// downloads because of RequireRelease, e.g. after it has passed a virus scan.
+// Releasing an upload which is not withheld has no effect. The upload is
+// locked like for AdminHoldUpload. The same authorization as for
+// AdminGetUpload applies.
+func (handler *UnroutedHandler) AdminReleaseDownload(w http.ResponseWriter, r *http.Request) {
+	ctx := newStoreContext(r)
+
+	if err := handler.authorizeAdminRequest(r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if !handler.composer.UsesReleaser {
+		handler.sendError(w, r, ErrNotImplemented)
+		return
+	}
+
+	id, err := extractIDFromPath(strings.TrimSuffix(r.URL.Path, "/release"))
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if handler.locksUploads() {
+		lock, err := handler.lockUpload(id)
+		if err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+
+		defer lock.Unlock()
+	}
+
+	if err := handler.composer.Releaser.ReleaseUpload(ctx, id); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	handler.log("DownloadReleased", "id", id)
+
+	handler.sendResp(w, r, http.StatusNoContent)
+}
+
+// authorizeAdminRequest invokes the AdminAuthorizeCallback. If it is not
+// configured, the endpoint is treated as non-existent.
+func (handler *UnroutedHandler) authorizeAdminRequest(r *http.Request) error {
+	if handler.config.AdminAuthorizeCallback == nil {
+		return ErrNotFound
+	}
+
+	return handler.config.AdminAuthorizeCallback(r)
+}
+
+// isAdminPath checks whether the request is directed at the admin endpoint.
+func (handler *UnroutedHandler) isAdminPath(path string) bool {
+	return handler.config.AdminAuthorizeCallback != nil && reAdminPath.MatchString(path)
+}
+
+// redactMetadata returns a copy of the metadata in which the values of the
+// SensitiveMetadataKeys are replaced.
+func (handler *UnroutedHandler) redactMetadata(meta MetaData) MetaData {
+	return redactValues(meta, handler.config.SensitiveMetadataKeys)
+}
+
+// redactValues returns a copy of the map in which the values of the sensitive
+// keys are replaced.
+func redactValues(values map[string]string, sensitive []string) map[string]string {
+	if values == nil {
+		return nil
+	}
+
+	redacted := make(map[string]string, len(values))
+	for key, value := range values {
+		if containsString(sensitive, key) {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+
+	return redacted
+}
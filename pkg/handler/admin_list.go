@@ -0,0 +1,341 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// adminListDefaultLimit is the number of uploads listed if the request does
+	// not specify a limit.
+	adminListDefaultLimit = 100
+	// adminListMaxLimit is the largest number of uploads listed in a single
+	// response.
+	adminListMaxLimit = 1000
+	// adminListPageSize is the number of uploads requested from the data store
+	// at once.
+	adminListPageSize = 100
+	// adminListMetadataPrefix prefixes the query parameters filtering uploads by
+	// their metadata.
+	adminListMetadataPrefix = "metadata."
+)
+
+// adminListColumns are the names of the columns of CSV responses of
+// AdminListUploads.
+var adminListColumns = []string{"ID", "Offset", "Size", "SizeIsDeferred", "OnHold", "AgeSeconds", "StorageKey", "MetaData"}
+
+// adminUploadRow describes a single upload in responses of AdminListUploads.
+type adminUploadRow struct {
+	ID             string
+	Offset         int64
+	Size           int64
+	SizeIsDeferred bool
+	OnHold         bool
+	// AgeSeconds is the time since the upload's creation. It is only set if the
+	// data store records the creation time.
+	AgeSeconds *int64 `json:",omitempty"`
+	// StorageKey is the upload's location in the data store, e.g. the object
+	// key for S3 or the file path for the filestore.
+	StorageKey string `json:",omitempty"`
+	MetaData   MetaData
+}
+
+// adminListQuery contains the paging and filter parameters of a request for
+// AdminListUploads.
+type adminListQuery struct {
+	cursor        string
+	limit         int
+	csv           bool
+	state         string
+	metadata      MetaData
+	createdBefore time.Time
+}
+
+// AdminListUploads responds with the uploads in the data store, ordered by
+// their IDs, as JSON or, if the format query parameter is csv, as CSV. At most
+// limit uploads, which defaults to 100, are included. The following query
+// parameters restrict the listing:
+//
+//	state=complete|incomplete|held
+//	metadata.<key>=<value>, e.g. metadata.owner=alice
+//	created_before=<RFC 3339 timestamp>
+//
+// Uploads for which the data store does not record the creation time never
+// match created_before. The values of the SensitiveMetadataKeys are redacted
+// and filtering by them is rejected. The StorageKey is redacted if it is
+// listed in the SensitiveStorageKeys.
+//
+// The uploads are fetched from the data store and written to the response
+// page by page. If more uploads may follow, the ID of the last listed one is
+// included as NextCursor in JSON responses and in the Next-Cursor trailer of
+// CSV responses. At most AdminListScanLimit uploads are fetched per request,
+// after which the ID of the last fetched one is included instead, even if
+// fewer than limit uploads have been listed. Passing it as the cursor
+// parameter continues the listing, which may also result in an empty
+// response. If the data store fails while the response is written, the
+// listing ends without the cursor, i.e. the JSON body is incomplete or the
+// trailer is missing. The same authorization as for
+// AdminGetUpload applies.
+func (handler *UnroutedHandler) AdminListUploads(w http.ResponseWriter, r *http.Request) {
+	ctx := newStoreContext(r)
+
+	if err := handler.authorizeAdminRequest(r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if !handler.composer.UsesLister {
+		handler.sendError(w, r, ErrNotImplemented)
+		return
+	}
+
+	query, err := handler.parseAdminListQuery(r)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	// Only fetch the first page before sending the response, so that a failing
+	// data store can still be reported using the status code.
+	lister := handler.composer.Lister
+	size := handler.adminListPageSize(0)
+	page, err := lister.ListUploads(ctx, query.cursor, size)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	var csvWriter *csv.Writer
+	if query.csv {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Trailer", "Next-Cursor")
+		handler.sendResp(w, r, http.StatusOK)
+		csvWriter = csv.NewWriter(w)
+		csvWriter.Write(adminListColumns)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		handler.sendResp(w, r, http.StatusOK)
+		w.Write([]byte(`{"Uploads":[`))
+	}
+
+	now := handler.now()
+	count := 0
+	scanned := 0
+	next := ""
+
+list:
+	for {
+		for _, info := range page {
+			if !query.matches(info) {
+				continue
+			}
+
+			row := handler.adminUploadRow(info, now)
+			if query.csv {
+				err = csvWriter.Write(row.csvRecord())
+			} else {
+				err = writeJSONRow(w, row, count == 0)
+			}
+			if err != nil {
+				handler.log("AdminListError", "error", err.Error())
+				return
+			}
+
+			count++
+			if count == query.limit {
+				next = info.ID
+				break list
+			}
+		}
+
+		if len(page) < size {
+			break
+		}
+
+		scanned += len(page)
+		size = handler.adminListPageSize(scanned)
+		if size == 0 {
+			next = page[len(page)-1].ID
+			break
+		}
+
+		page, err = lister.ListUploads(ctx, page[len(page)-1].ID, size)
+		if err != nil {
+			handler.log("AdminListError", "error", err.Error())
+			return
+		}
+	}
+
+	if query.csv {
+		csvWriter.Flush()
+		w.Header().Set("Next-Cursor", next)
+		return
+	}
+
+	result, _ := json.Marshal(next)
+	w.Write([]byte(`],"NextCursor":`))
+	w.Write(result)
+	w.Write([]byte("}\n"))
+}
+
+// parseAdminListQuery extracts the paging and filter parameters from the
+// request's query.
+func (handler *UnroutedHandler) parseAdminListQuery(r *http.Request) (adminListQuery, error) {
+	values := r.URL.Query()
+	query := adminListQuery{
+		cursor: values.Get("cursor"),
+		limit:  adminListDefaultLimit,
+		state:  values.Get("state"),
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > adminListMaxLimit {
+			return query, ErrInvalidListQuery
+		}
+		query.limit = limit
+	}
+
+	switch values.Get("format") {
+	case "", "json":
+	case "csv":
+		query.csv = true
+	default:
+		return query, ErrInvalidListQuery
+	}
+
+	switch query.state {
+	case "", "complete", "incomplete", "held":
+	default:
+		return query, ErrInvalidListQuery
+	}
+
+	if raw := values.Get("created_before"); raw != "" {
+		createdBefore, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return query, ErrInvalidListQuery
+		}
+		query.createdBefore = createdBefore
+	}
+
+	for name := range values {
+		if !strings.HasPrefix(name, adminListMetadataPrefix) {
+			continue
+		}
+
+		// Filtering by sensitive values would allow guessing them
+		key := strings.TrimPrefix(name, adminListMetadataPrefix)
+		if containsString(handler.config.SensitiveMetadataKeys, key) {
+			return query, ErrInvalidListQuery
+		}
+
+		if query.metadata == nil {
+			query.metadata = make(MetaData)
+		}
+		query.metadata[key] = values.Get(name)
+	}
+
+	return query, nil
+}
+
+// matches checks whether the upload passes the query's filters.
+func (query adminListQuery) matches(info FileInfo) bool {
+	complete := !info.SizeIsDeferred && info.Offset == info.Size
+	switch {
+	case query.state == "complete" && !complete,
+		query.state == "incomplete" && complete,
+		query.state == "held" && !info.OnHold:
+		return false
+	}
+
+	for key, value := range query.metadata {
+		if actual, ok := info.MetaData[key]; !ok || actual != value {
+			return false
+		}
+	}
+
+	if !query.createdBefore.IsZero() && (info.CreatedAt == nil || !info.CreatedAt.Before(query.createdBefore)) {
+		return false
+	}
+
+	return true
+}
+
+// adminListPageSize returns the number of uploads to request from the data
+// store for the next page of AdminListUploads, after the given number of
+// uploads has already been fetched. Zero means that AdminListScanLimit has
+// been reached.
+func (handler *UnroutedHandler) adminListPageSize(scanned int) int {
+	size := handler.config.AdminListScanLimit - scanned
+	if size > adminListPageSize {
+		size = adminListPageSize
+	}
+	return size
+}
+
+// adminUploadRow summarizes the upload for AdminListUploads.
+func (handler *UnroutedHandler) adminUploadRow(info FileInfo, now time.Time) adminUploadRow {
+	row := adminUploadRow{
+		ID:             info.ID,
+		Offset:         info.Offset,
+		Size:           info.Size,
+		SizeIsDeferred: info.SizeIsDeferred,
+		OnHold:         info.OnHold,
+		MetaData:       handler.redactMetadata(info.MetaData),
+	}
+
+	storage := redactValues(info.Storage, handler.config.SensitiveStorageKeys)
+	row.StorageKey = storage["Key"]
+	if row.StorageKey == "" {
+		row.StorageKey = storage["Path"]
+	}
+
+	if info.CreatedAt != nil {
+		age := int64(now.Sub(*info.CreatedAt).Seconds())
+		row.AgeSeconds = &age
+	}
+
+	return row
+}
+
+// csvRecord returns the row's fields in the order of adminListColumns. The
+// metadata is encoded as JSON.
+func (row adminUploadRow) csvRecord() []string {
+	age := ""
+	if row.AgeSeconds != nil {
+		age = strconv.FormatInt(*row.AgeSeconds, 10)
+	}
+
+	meta, _ := json.Marshal(row.MetaData)
+
+	return []string{
+		row.ID,
+		strconv.FormatInt(row.Offset, 10),
+		strconv.FormatInt(row.Size, 10),
+		strconv.FormatBool(row.SizeIsDeferred),
+		strconv.FormatBool(row.OnHold),
+		age,
+		row.StorageKey,
+		string(meta),
+	}
+}
+
+// writeJSONRow appends the row to the Uploads array of a JSON response.
+func writeJSONRow(w http.ResponseWriter, row adminUploadRow, first bool) error {
+	result, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	if !first {
+		result = append([]byte(","), result...)
+	}
+
+	_, err = w.Write(result)
+	return err
+}
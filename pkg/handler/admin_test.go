@@ -0,0 +1,720 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+	"github.com/tus/tusd/pkg/memorylocker"
+)
+
+func authorizeAdmin(r *http.Request) error {
+	if r.Header.Get("Authorization") != "Bearer admin" {
+		return NewHTTPError(errors.New("admin access denied"), http.StatusUnauthorized)
+	}
+	return nil
+}
+
+func TestAdminGetUpload(t *testing.T) {
+	SubTest(t, "Success", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		expiresAt := createdAt.Add(24 * time.Hour)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+				MetaData: MetaData{
+					"filename": "hello.txt",
+					"token":    "secret",
+				},
+				Storage: map[string]string{
+					"Type": "filestore",
+					"Path": "/data/yes",
+					"URL":  "https://example.com/yes?signature=secret",
+				},
+				CreatedAt: &createdAt,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(expiresAt, nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+			SensitiveMetadataKeys:  []string{"token"},
+			SensitiveStorageKeys:   []string{"URL"},
+		})
+
+		res := (&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads/yes",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type":  "application/json; charset=utf-8",
+				"Cache-Control": "no-store",
+			},
+		}).Run(handler, t)
+
+		var body struct {
+			ID        string
+			Offset    int64
+			Size      int64
+			MetaData  map[string]string
+			Storage   map[string]string
+			CreatedAt time.Time
+			ExpiresAt time.Time
+		}
+
+		a := assert.New(t)
+		a.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+		a.Equal("yes", body.ID)
+		a.EqualValues(5, body.Offset)
+		a.EqualValues(20, body.Size)
+		a.Equal(map[string]string{
+			"filename": "hello.txt",
+			"token":    "[REDACTED]",
+		}, body.MetaData)
+		a.Equal(map[string]string{
+			"Type": "filestore",
+			"Path": "/data/yes",
+			"URL":  "[REDACTED]",
+		}, body.Storage)
+		a.True(createdAt.Equal(body.CreatedAt))
+		a.True(expiresAt.Equal(body.ExpiresAt))
+	})
+
+	SubTest(t, "Unauthorized", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads/yes",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer user",
+			},
+			Code:    http.StatusUnauthorized,
+			ResBody: "admin access denied\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotFound", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(context.Background(), "no").Return(nil, ErrNotFound)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads/no",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNotFound,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotConfigured", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads/yes",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNotFound,
+		}).Run(handler, t)
+
+		unrouted, _ := NewUnroutedHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads/yes",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNotFound,
+		}).Run(http.HandlerFunc(unrouted.AdminGetUpload), t)
+	})
+}
+
+func TestAdminHoldUpload(t *testing.T) {
+	SubTest(t, "HoldAndRelease", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-hold-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			BasePath:               "/files/",
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "10",
+				"Content-Type":  "application/offset+octet-stream",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		(&httpTest{
+			Name:   "Unauthorized",
+			Method: "PUT",
+			URL:    "admin/uploads/" + id + "/hold",
+			Code:   http.StatusUnauthorized,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Hold",
+			Method: "PUT",
+			URL:    "admin/uploads/" + id + "/hold",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Refused",
+			Method: "PATCH",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusLocked,
+			ResBody: "upload is on hold\n",
+			ResHeader: map[string]string{
+				"Retry-After": "",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Poll",
+			Method: "HEAD",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset":  "5",
+				"Upload-On-Hold": "true",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Release",
+			Method: "DELETE",
+			URL:    "admin/uploads/" + id + "/hold",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Resume",
+			Method: "PATCH",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "10",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:    "Download",
+			Method:  "GET",
+			URL:     id,
+			Code:    http.StatusOK,
+			ResBody: "helloworld",
+			ResHeader: map[string]string{
+				"Upload-On-Hold": "",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Locked", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-hold-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+		memorylocker.New().UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			BasePath:               "/files/",
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "10",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		// A PATCH request in progress holds the lock
+		lock, err := composer.Locker.NewLock(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lock.Lock(); err != nil {
+			t.Fatal(err)
+		}
+
+		hold := &httpTest{
+			Method: "PUT",
+			URL:    "admin/uploads/" + id + "/hold",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusLocked,
+		}
+		hold.Run(handler, t)
+
+		lock.Unlock()
+		hold.Code = http.StatusNoContent
+		hold.Run(handler, t)
+	})
+
+	SubTest(t, "CustomStatusCode", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+				OnHold: true,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			HeldUploadStatusCode: http.StatusForbidden,
+			JSONErrors:           true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusForbidden,
+			ResBody: `{"code":"ERR_UPLOAD_ON_HOLD","message":"upload is on hold"}` + "\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotSupported", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		(&httpTest{
+			Method: "PUT",
+			URL:    "admin/uploads/yes/hold",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNotImplemented,
+		}).Run(http.HandlerFunc(handler.AdminHoldUpload), t)
+	})
+}
+
+// listStore is a data store containing only the information about a fixed set
+// of uploads, which can be listed.
+type listStore struct {
+	infos []FileInfo
+}
+
+func (store listStore) NewUpload(ctx context.Context, info FileInfo) (Upload, error) {
+	return nil, ErrNotImplemented
+}
+
+func (store listStore) GetUpload(ctx context.Context, id string) (Upload, error) {
+	return nil, ErrNotFound
+}
+
+func (store listStore) ListUploads(ctx context.Context, after string, limit int) ([]FileInfo, error) {
+	i := sort.Search(len(store.infos), func(i int) bool {
+		return store.infos[i].ID > after
+	})
+
+	infos := store.infos[i:]
+	if len(infos) > limit {
+		infos = infos[:limit]
+	}
+	return infos, nil
+}
+
+// adminListBody is the body of responses of the admin endpoint listing uploads.
+type adminListBody struct {
+	Uploads []struct {
+		ID         string
+		Offset     int64
+		Size       int64
+		OnHold     bool
+		AgeSeconds *int64
+		StorageKey string
+		MetaData   map[string]string
+	}
+	NextCursor string
+}
+
+func TestAdminListUploads(t *testing.T) {
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Every third upload is complete, every tenth one is held and every other
+	// one belongs to alice.
+	store := listStore{}
+	for i := 0; i < 300; i++ {
+		info := FileInfo{
+			ID:     fmt.Sprintf("upload-%03d", i),
+			Offset: 5,
+			Size:   10,
+			OnHold: i%10 == 0,
+			MetaData: MetaData{
+				"owner": "bob",
+				"token": "secret",
+			},
+			Storage: map[string]string{
+				"Key": fmt.Sprintf("key-%03d", i),
+			},
+		}
+		if i%3 == 0 {
+			info.Offset = 10
+		}
+		if i%2 == 0 {
+			info.MetaData["owner"] = "alice"
+		}
+		if i < 250 {
+			created := createdAt.Add(time.Duration(i) * time.Hour)
+			info.CreatedAt = &created
+		}
+		store.infos = append(store.infos, info)
+	}
+
+	setup := func(sensitiveStorageKeys ...string) *Handler {
+		composer := NewStoreComposer()
+		composer.UseCore(store)
+		composer.UseLister(store)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+			SensitiveMetadataKeys:  []string{"token"},
+			SensitiveStorageKeys:   sensitiveStorageKeys,
+		})
+		return handler
+	}
+
+	list := func(t *testing.T, handler *Handler, query string) adminListBody {
+		res := (&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads?" + query,
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type":  "application/json; charset=utf-8",
+				"Cache-Control": "no-store",
+			},
+		}).Run(handler, t)
+
+		var body adminListBody
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	SubTest(t, "Paging", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler := setup()
+		a := assert.New(t)
+
+		body := list(t, handler, "")
+		a.Len(body.Uploads, 100)
+		a.Equal("upload-099", body.NextCursor)
+
+		var ids, cursors []string
+		cursor := ""
+		for {
+			body := list(t, handler, "limit=120&cursor="+cursor)
+			for _, upload := range body.Uploads {
+				ids = append(ids, upload.ID)
+			}
+			cursors = append(cursors, body.NextCursor)
+			if body.NextCursor == "" {
+				break
+			}
+			cursor = body.NextCursor
+		}
+
+		a.Equal([]string{"upload-119", "upload-239", ""}, cursors)
+		a.Len(ids, 300)
+		for i, id := range ids {
+			a.Equal(store.infos[i].ID, id)
+		}
+
+		// A listing ending exactly at the last upload is followed by an empty one
+		body = list(t, handler, "limit=150&cursor=upload-149")
+		a.Len(body.Uploads, 150)
+		a.Equal("upload-299", body.NextCursor)
+		body = list(t, handler, "limit=150&cursor=upload-299")
+		a.Len(body.Uploads, 0)
+		a.Equal("", body.NextCursor)
+	})
+
+	SubTest(t, "ScanLimit", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		composer := NewStoreComposer()
+		composer.UseCore(store)
+		composer.UseLister(store)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+			AdminListScanLimit:     150,
+		})
+		a := assert.New(t)
+
+		// Filters matching no upload stop after the scan limit
+		body := list(t, handler, "metadata.owner=nobody")
+		a.Len(body.Uploads, 0)
+		a.Equal("upload-149", body.NextCursor)
+		body = list(t, handler, "metadata.owner=nobody&cursor=upload-149")
+		a.Len(body.Uploads, 0)
+		a.Equal("upload-299", body.NextCursor)
+		body = list(t, handler, "metadata.owner=nobody&cursor=upload-299")
+		a.Len(body.Uploads, 0)
+		a.Equal("", body.NextCursor)
+
+		// The limit is reached before the scan limit
+		body = list(t, handler, "state=held")
+		a.Len(body.Uploads, 15)
+		a.Equal("upload-149", body.NextCursor)
+		body = list(t, handler, "state=held&limit=5")
+		a.Len(body.Uploads, 5)
+		a.Equal("upload-040", body.NextCursor)
+	})
+
+	SubTest(t, "Rows", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		body := list(t, setup(), "limit=1&cursor=upload-002")
+		a := assert.New(t)
+		a.Len(body.Uploads, 1)
+
+		upload := body.Uploads[0]
+		a.Equal("upload-003", upload.ID)
+		a.EqualValues(10, upload.Offset)
+		a.EqualValues(10, upload.Size)
+		a.False(upload.OnHold)
+		a.Equal("key-003", upload.StorageKey)
+		a.Equal(map[string]string{
+			"owner": "bob",
+			"token": "[REDACTED]",
+		}, upload.MetaData)
+		a.NotNil(upload.AgeSeconds)
+		a.InDelta(time.Since(createdAt.Add(3*time.Hour)).Seconds(), *upload.AgeSeconds, 5)
+
+		body = list(t, setup(), "limit=1&cursor=upload-298")
+		a.Nil(body.Uploads[0].AgeSeconds)
+
+		body = list(t, setup("Key"), "limit=1&cursor=upload-002")
+		a.Equal("[REDACTED]", body.Uploads[0].StorageKey)
+	})
+
+	SubTest(t, "Filters", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler := setup()
+		a := assert.New(t)
+
+		body := list(t, handler, "limit=1000&state=complete")
+		a.Len(body.Uploads, 100)
+		a.Equal("", body.NextCursor)
+		for _, upload := range body.Uploads {
+			a.Equal(upload.Size, upload.Offset)
+		}
+
+		body = list(t, handler, "limit=1000&state=incomplete")
+		a.Len(body.Uploads, 200)
+
+		body = list(t, handler, "limit=1000&state=held")
+		a.Len(body.Uploads, 30)
+		for _, upload := range body.Uploads {
+			a.True(upload.OnHold)
+		}
+
+		body = list(t, handler, "limit=1000&state=complete&metadata.owner=alice")
+		a.Len(body.Uploads, 50)
+		for _, upload := range body.Uploads {
+			a.Equal("alice", upload.MetaData["owner"])
+		}
+
+		// Uploads without a creation time are excluded
+		body = list(t, handler, "limit=1000&created_before=2020-01-05T04:00:00Z")
+		a.Len(body.Uploads, 100)
+		a.Equal("upload-099", body.Uploads[99].ID)
+		body = list(t, handler, "limit=1000&created_before=2030-01-01T00:00:00Z")
+		a.Len(body.Uploads, 250)
+
+		// The limit applies to the matching uploads, spanning multiple pages
+		body = list(t, handler, "limit=40&state=complete")
+		a.Len(body.Uploads, 40)
+		a.Equal("upload-117", body.NextCursor)
+		body = list(t, handler, "limit=1000&state=complete&cursor=upload-117")
+		a.Len(body.Uploads, 60)
+		a.Equal("upload-120", body.Uploads[0].ID)
+	})
+
+	SubTest(t, "CSV", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		res := (&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads?format=csv&limit=150&state=held",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type": "text/csv; charset=utf-8",
+			},
+		}).Run(setup(), t)
+
+		records, err := csv.NewReader(res.Body).ReadAll()
+		a := assert.New(t)
+		a.NoError(err)
+		a.Len(records, 31)
+		a.Equal([]string{"ID", "Offset", "Size", "SizeIsDeferred", "OnHold", "AgeSeconds", "StorageKey", "MetaData"}, records[0])
+		a.Equal([]string{"upload-000", "10", "10", "false", "true"}, records[1][:5])
+		a.Equal("key-000", records[1][6])
+		a.Equal(`{"owner":"alice","token":"[REDACTED]"}`, records[1][7])
+		a.Equal("upload-290", records[30][0])
+		a.Equal("", records[30][5])
+		a.Equal("", res.Result().Trailer.Get("Next-Cursor"))
+
+		res = (&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads?format=csv&limit=10",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusOK,
+		}).Run(setup(), t)
+		a.Equal("upload-009", res.Result().Trailer.Get("Next-Cursor"))
+	})
+
+	SubTest(t, "InvalidQuery", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler := setup()
+
+		for _, query := range []string{
+			"limit=0",
+			"limit=1001",
+			"limit=abc",
+			"format=xml",
+			"state=unknown",
+			"created_before=yesterday",
+			// Filtering by sensitive values would allow guessing them
+			"metadata.token=secret",
+		} {
+			(&httpTest{
+				Name:   query,
+				Method: "GET",
+				URL:    "admin/uploads?" + query,
+				ReqHeader: map[string]string{
+					"Authorization": "Bearer admin",
+				},
+				Code:    http.StatusBadRequest,
+				ResBody: "invalid query for listing uploads\n",
+			}).Run(handler, t)
+		}
+	})
+
+	SubTest(t, "Unauthorized", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		(&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads",
+			Code:   http.StatusUnauthorized,
+		}).Run(setup(), t)
+	})
+
+	SubTest(t, "NotSupported", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewUnroutedHandler(Config{
+			StoreComposer:          composer,
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "admin/uploads",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNotImplemented,
+		}).Run(http.HandlerFunc(handler.AdminListUploads), t)
+	})
+}
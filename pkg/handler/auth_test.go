@@ -0,0 +1,243 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+var (
+	errUnauthorized = NewHTTPError(errors.New("missing credentials"), http.StatusUnauthorized)
+	errForbidden    = NewHTTPError(errors.New("upload belongs to another user"), http.StatusForbidden)
+)
+
+// authorizeOwner is an AuthorizeRequestCallback which records the user from
+// the Authorization header as the owner of new uploads and only allows the
+// owner to access them afterwards.
+func authorizeOwner(hook HookEvent) (FileInfoChanges, error) {
+	user := strings.TrimPrefix(hook.HTTPRequest.Header.Get("Authorization"), "Bearer ")
+	if user == "" {
+		return FileInfoChanges{}, errUnauthorized
+	}
+
+	if hook.HTTPRequest.Method == "POST" {
+		meta := make(MetaData, len(hook.Upload.MetaData)+1)
+		for key, value := range hook.Upload.MetaData {
+			meta[key] = value
+		}
+		meta["owner"] = user
+		return FileInfoChanges{MetaData: meta}, nil
+	}
+
+	if hook.Upload.MetaData["owner"] != user {
+		return FileInfoChanges{}, errForbidden
+	}
+
+	return FileInfoChanges{}, nil
+}
+
+func TestAuthorizeRequest(t *testing.T) {
+	SubTest(t, "Owner", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-auth-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:            composer,
+			BasePath:                 "/files/",
+			AuthorizeRequestCallback: authorizeOwner,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "10",
+			},
+			Code: http.StatusUnauthorized,
+		}).Run(handler, t)
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Upload-Metadata": "owner Ym9i",
+				"Authorization":   "Bearer alice",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		upload, err := composer.Core.GetUpload(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := upload.GetInfo(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "alice", info.MetaData["owner"])
+
+		(&httpTest{
+			Name:   "Other user's PATCH",
+			Method: "PATCH",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+				"Authorization": "Bearer bob",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusForbidden,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Other user's DELETE",
+			Method: "DELETE",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Authorization": "Bearer bob",
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Owner's PATCH",
+			Method: "PATCH",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+				"Authorization": "Bearer alice",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Owner's DELETE",
+			Method: "DELETE",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Authorization": "Bearer alice",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Concat", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-auth-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:            composer,
+			BasePath:                 "/files/",
+			AuthorizeRequestCallback: authorizeOwner,
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+				"Upload-Concat": "partial",
+				"Content-Type":  "application/offset+octet-stream",
+				"Authorization": "Bearer alice",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+		}).Run(handler, t)
+		partial := res.Header().Get("Location")
+
+		(&httpTest{
+			Name:   "Other user's concatenation",
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Concat": "final;" + partial,
+				"Authorization": "Bearer bob",
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Owner's concatenation",
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Concat": "final;" + partial,
+				"Authorization": "Bearer alice",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Head", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+				MetaData: map[string]string{
+					"owner": "alice",
+				},
+			}, nil),
+		)
+
+		var event HookEvent
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			AuthorizeRequestCallback: func(hook HookEvent) (FileInfoChanges, error) {
+				event = hook
+				return authorizeOwner(hook)
+			},
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Authorization": "Bearer bob",
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal("HEAD", event.HTTPRequest.Method)
+		a.Equal("yes", event.Upload.ID)
+	})
+}
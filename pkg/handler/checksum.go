@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// checksumAlgorithms maps the names of the supported checksum algorithms, as
+// used in the Upload-Checksum header, to their implementations.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// supportedChecksumAlgorithms is sent in the Tus-Checksum-Algorithm header.
+const supportedChecksumAlgorithms = "md5,sha1,sha256"
+
+// checksum verifies the content of a chunk against the checksum supplied by
+// the client, either in the Upload-Checksum header or, if the client computes
+// it while sending the body, in the Upload-Checksum trailer. In the latter
+// case, the algorithm must be announced in the Upload-Checksum-Algorithm
+// header, so the body can be hashed while it is read.
+type checksum struct {
+	algorithm string
+	hash      hash.Hash
+	// expected is the digest from the Upload-Checksum header. It is nil if the
+	// checksum is sent as trailer.
+	expected []byte
+	trailer  bool
+}
+
+// parseChecksum returns the checksum the request's body must match. If
+// the request includes no checksum, nil is returned.
+func parseChecksum(r *http.Request) (*checksum, error) {
+	if value := r.Header.Get("Upload-Checksum"); value != "" {
+		algorithm, digest, err := parseChecksumValue(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &checksum{
+			algorithm: algorithm,
+			hash:      checksumAlgorithms[algorithm](),
+			expected:  digest,
+		}, nil
+	}
+
+	// The net/http package adds the trailers announced in the Trailer header
+	// to the request, but only fills in their values once the body is read.
+	if _, ok := r.Trailer["Upload-Checksum"]; ok {
+		algorithm := strings.ToLower(r.Header.Get("Upload-Checksum-Algorithm"))
+		newHash, ok := checksumAlgorithms[algorithm]
+		if !ok {
+			return nil, ErrUnsupportedChecksumAlgorithm
+		}
+
+		return &checksum{
+			algorithm: algorithm,
+			hash:      newHash(),
+			trailer:   true,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// parseChecksumValue parses a value of the Upload-Checksum header or trailer,
+// which consists of the algorithm and the Base64-encoded digest separated by
+// a space.
+func parseChecksumValue(value string) (string, []byte, error) {
+	parts := strings.SplitN(value, " ", 2)
+	if len(parts) != 2 {
+		return "", nil, ErrInvalidChecksum
+	}
+
+	algorithm := strings.ToLower(parts[0])
+	if _, ok := checksumAlgorithms[algorithm]; !ok {
+		return "", nil, ErrUnsupportedChecksumAlgorithm
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, ErrInvalidChecksum
+	}
+
+	return algorithm, digest, nil
+}
+
+// wrap returns a reader which feeds all data read from r into the checksum.
+func (c *checksum) wrap(r io.Reader) io.Reader {
+	return io.TeeReader(r, c.hash)
+}
+
+// verify compares the digest of the data read so far with the expected one.
+// For checksums sent as trailer, the request body must not contain any more
+// data, since trailers are only available once the entire body is consumed.
+func (c *checksum) verify(r *http.Request) error {
+	expected := c.expected
+	if c.trailer {
+		// Read until the end of the body, so that the trailers are parsed. If there
+		// is more data than the handler accepts, the trailer remains unavailable.
+		if r.Body != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(r.Body, 1))
+		}
+
+		algorithm, digest, err := parseChecksumValue(r.Trailer.Get("Upload-Checksum"))
+		if err != nil {
+			return err
+		}
+		if algorithm != c.algorithm {
+			return ErrInvalidChecksum
+		}
+		expected = digest
+	}
+
+	if !bytes.Equal(c.hash.Sum(nil), expected) {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
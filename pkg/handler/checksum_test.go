@@ -0,0 +1,330 @@
+package handler_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+// SHA-1 digests of "hello" and "world", encoded using Base64
+const (
+	helloSHA1 = "qvTGHdzF6KLavt4PO0gs2a6pQ00="
+	worldSHA1 = "fCEUM/AgcVl3Qeb/Wo6jR4mrv0M="
+)
+
+func TestChecksum(t *testing.T) {
+	SubTest(t, "ExtensionDiscovery", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer.UseTruncater(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Tus-Extension":          "creation,creation-with-upload,termination,concatenation,creation-defer-length,checksum,checksum-trailer",
+				"Tus-Checksum-Algorithm": "md5,sha1,sha256",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Header", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		composer.UseTruncater(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "5",
+				"Upload-Checksum": "sha1 " + helloSHA1,
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "10",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "HeaderMismatch", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			store.EXPECT().AsTruncatableUpload(upload).Return(upload),
+			upload.EXPECT().Truncate(context.Background(), int64(5)).Return(nil),
+		)
+
+		composer.UseTruncater(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "5",
+				"Upload-Checksum": "sha1 " + worldSHA1,
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    460,
+			ResBody: "checksum mismatch\n",
+			ResHeader: map[string]string{
+				"Upload-Offset": "",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UnsupportedAlgorithm", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+		)
+
+		composer.UseTruncater(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "5",
+				"Upload-Checksum": "crc32 AAAAAA==",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusBadRequest,
+			ResBody: "unsupported checksum algorithm\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotSupportedByStore", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Content-Type":    "application/offset+octet-stream",
+				"Upload-Offset":   "5",
+				"Upload-Checksum": "sha1 " + helloSHA1,
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNotImplemented,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Trailer", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-checksum-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		// Trailers are only parsed by a real HTTP server for chunked bodies
+		server := httptest.NewServer(http.StripPrefix("/files/", handler))
+		defer server.Close()
+
+		a := assert.New(t)
+
+		req, _ := http.NewRequest("POST", server.URL+"/files/", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "10")
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal(http.StatusCreated, res.StatusCode)
+		url := res.Header.Get("Location")
+
+		patch := func(offset, body, algorithm, trailer string) *http.Response {
+			// Hide the body's length, so that it is sent chunked
+			req, _ := http.NewRequest("PATCH", url, ioutil.NopCloser(io.MultiReader(strings.NewReader(body))))
+			req.ContentLength = -1
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			req.Header.Set("Upload-Offset", offset)
+			req.Header.Set("Upload-Checksum-Algorithm", algorithm)
+			req.Trailer = http.Header{
+				"Upload-Checksum": []string{trailer},
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			a.NoError(err)
+			res.Body.Close()
+			return res
+		}
+
+		res = patch("0", "hello", "sha1", "sha1 "+helloSHA1)
+		a.Equal(http.StatusNoContent, res.StatusCode)
+		a.Equal("5", res.Header.Get("Upload-Offset"))
+
+		// The mismatching chunk is removed again
+		res = patch("5", "earth", "sha1", "sha1 "+worldSHA1)
+		a.Equal(460, res.StatusCode)
+
+		res = patch("5", "world", "sha1", "sha256 "+worldSHA1)
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+
+		req, _ = http.NewRequest("HEAD", url, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		res, err = http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal("5", res.Header.Get("Upload-Offset"))
+
+		res = patch("5", "world", "sha1", "sha1 "+worldSHA1)
+		a.Equal(http.StatusNoContent, res.StatusCode)
+		a.Equal("10", res.Header.Get("Upload-Offset"))
+
+		res, err = http.Get(url)
+		a.NoError(err)
+		content, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		a.NoError(err)
+		a.Equal("helloworld", string(content))
+	})
+
+	SubTest(t, "CutOff", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-checksum-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			MaxChunkSize:  5,
+		})
+
+		server := httptest.NewServer(http.StripPrefix("/files/", handler))
+		defer server.Close()
+
+		a := assert.New(t)
+
+		req, _ := http.NewRequest("POST", server.URL+"/files/", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "10")
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		url := res.Header.Get("Location")
+
+		patch := func(body string, chunked bool) *http.Response {
+			digest := sha1.Sum([]byte(body))
+			req, _ := http.NewRequest("PATCH", url, strings.NewReader(body))
+			if chunked {
+				req.Body = ioutil.NopCloser(io.MultiReader(strings.NewReader(body)))
+				req.ContentLength = -1
+			}
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+			req.Header.Set("Upload-Offset", "0")
+			req.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(digest[:]))
+
+			res, err := http.DefaultClient.Do(req)
+			a.NoError(err)
+			res.Body.Close()
+			return res
+		}
+
+		// The checksum of a body exceeding the maximum chunk size cannot be
+		// verified, which is not reported as a mismatch
+		res = patch("helloworld", false)
+		a.Equal(http.StatusRequestEntityTooLarge, res.StatusCode)
+		res = patch("helloworld", true)
+		a.Equal(http.StatusRequestEntityTooLarge, res.StatusCode)
+
+		req, _ = http.NewRequest("HEAD", url, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		res, err = http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal("0", res.Header.Get("Upload-Offset"))
+
+		res = patch("hello", true)
+		a.Equal(http.StatusNoContent, res.StatusCode)
+		a.Equal("5", res.Header.Get("Upload-Offset"))
+	})
+}
@@ -6,14 +6,26 @@ package handler
 type StoreComposer struct {
 	Core DataStore
 
-	UsesTerminater     bool
-	Terminater         TerminaterDataStore
-	UsesLocker         bool
-	Locker             Locker
-	UsesConcater       bool
-	Concater           ConcaterDataStore
-	UsesLengthDeferrer bool
-	LengthDeferrer     LengthDeferrerDataStore
+	UsesTerminater      bool
+	Terminater          TerminaterDataStore
+	UsesLocker          bool
+	Locker              Locker
+	UsesConcater        bool
+	Concater            ConcaterDataStore
+	UsesLengthDeferrer  bool
+	LengthDeferrer      LengthDeferrerDataStore
+	UsesExpirer         bool
+	Expirer             ExpirerDataStore
+	UsesTruncater       bool
+	Truncater           TruncaterDataStore
+	UsesHolder          bool
+	Holder              HolderDataStore
+	UsesLister          bool
+	Lister              ListerDataStore
+	UsesMetaDataUpdater bool
+	MetaDataUpdater     MetaDataUpdaterDataStore
+	UsesReleaser        bool
+	Releaser            ReleaserDataStore
 }
 
 // NewStoreComposer creates a new and empty store composer.
@@ -56,6 +68,42 @@ func (store *StoreComposer) Capabilities() string {
 	} else {
 		str += "✗"
 	}
+	str += ` Expirer: `
+	if store.UsesExpirer {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Truncater: `
+	if store.UsesTruncater {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Holder: `
+	if store.UsesHolder {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Lister: `
+	if store.UsesLister {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` MetaDataUpdater: `
+	if store.UsesMetaDataUpdater {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
+	str += ` Releaser: `
+	if store.UsesReleaser {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
 
 	return str
 }
@@ -85,3 +133,33 @@ func (store *StoreComposer) UseLengthDeferrer(ext LengthDeferrerDataStore) {
 	store.UsesLengthDeferrer = ext != nil
 	store.LengthDeferrer = ext
 }
+
+func (store *StoreComposer) UseExpirer(ext ExpirerDataStore) {
+	store.UsesExpirer = ext != nil
+	store.Expirer = ext
+}
+
+func (store *StoreComposer) UseTruncater(ext TruncaterDataStore) {
+	store.UsesTruncater = ext != nil
+	store.Truncater = ext
+}
+
+func (store *StoreComposer) UseHolder(ext HolderDataStore) {
+	store.UsesHolder = ext != nil
+	store.Holder = ext
+}
+
+func (store *StoreComposer) UseLister(ext ListerDataStore) {
+	store.UsesLister = ext != nil
+	store.Lister = ext
+}
+
+func (store *StoreComposer) UseMetaDataUpdater(ext MetaDataUpdaterDataStore) {
+	store.UsesMetaDataUpdater = ext != nil
+	store.MetaDataUpdater = ext
+}
+
+func (store *StoreComposer) UseReleaser(ext ReleaserDataStore) {
+	store.UsesReleaser = ext != nil
+	store.Releaser = ext
+}
@@ -143,6 +143,15 @@ func TestConcat(t *testing.T) {
 				}, nil),
 				store.EXPECT().AsConcatableUpload(uploadC).Return(uploadC),
 				uploadC.EXPECT().ConcatUploads(context.Background(), []Upload{uploadA, uploadB}).Return(nil),
+				uploadC.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:             "foo",
+					Size:           10,
+					Offset:         10,
+					IsPartial:      false,
+					IsFinal:        true,
+					PartialUploads: []string{"a", "b"},
+					MetaData:       make(map[string]string),
+				}, nil),
 			)
 
 			handler, _ := NewHandler(Config{
@@ -2,9 +2,24 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultChunkSizeBuckets ranges from 16KiB to 1GiB in powers of four.
+	DefaultChunkSizeBuckets = []float64{1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26, 1 << 28, 1 << 30}
+	// DefaultPatchDurationBuckets ranges from 10ms to 10min.
+	DefaultPatchDurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600}
 )
 
 // Config provides a way to configure the Handler depending on your needs.
@@ -17,6 +32,14 @@ type Config struct {
 	// MaxSize defines how many bytes may be stored in one single upload. If its
 	// value is is 0 or smaller no limit will be enforced.
 	MaxSize int64
+	// MaxChunkSize defines how many bytes of a request's body are passed to the
+	// data store in one single PATCH or creation request. Bodies exceeding this
+	// limit are cut off and the client is informed about the new offset, so it
+	// can continue with another request. Since their checksum cannot be
+	// verified, such bodies are rejected with 413 Request Entity Too Large if
+	// the request carries a checksum. If its value is 0 or smaller no limit
+	// will be enforced.
+	MaxChunkSize int64
 	// BasePath defines the URL path used for handling uploads, e.g. "/files/".
 	// If no trailing slash is presented it will be added. You may specify an
 	// absolute URL containing a scheme, e.g. "http://tus.io"
@@ -40,11 +63,232 @@ type Config struct {
 	// potentially set by proxies when generating an absolute URL in the
 	// response to POST requests.
 	RespectForwardedHeaders bool
+	// StrictMetadata indicates whether creation requests with a malformed
+	// Upload-Metadata header, e.g. containing values which are not valid base64,
+	// are rejected. By default, malformed elements are ignored.
+	StrictMetadata bool
+	// AllowedMetadataKeys lists the only metadata keys which clients may set on
+	// creation. If it is empty, all keys are allowed.
+	AllowedMetadataKeys []string
+	// DeniedMetadataKeys lists the metadata keys which clients may not set on
+	// creation.
+	DeniedMetadataKeys []string
+	// ReservedMetadataKeys lists the metadata keys which only the server may
+	// set, e.g. an upload's owner. They are removed from the client's metadata
+	// before any callback is invoked.
+	ReservedMetadataKeys []string
+	// MetadataValidators maps metadata keys to functions validating their
+	// values on creation. If a function returns an error, the request is
+	// rejected.
+	MetadataValidators map[string]func(value string) error
+	// ClientIPMetadataKey is the metadata key under which the IP address of the
+	// client creating an upload is recorded. The address is taken from the
+	// X-Forwarded-For header if the request has been passed on by one of the
+	// TrustedProxies. If it is empty, no address is recorded.
+	ClientIPMetadataKey string
+	// UserAgentMetadataKey is the metadata key under which the User-Agent header
+	// of the request creating an upload is recorded. If it is empty, the user
+	// agent is not recorded. Requests without the header get no such key.
+	UserAgentMetadataKey string
+	// HeaderMetadataKeys maps names of request headers to the metadata keys
+	// under which their values are recorded when an upload is created. Headers
+	// missing from the request are not recorded.
+	HeaderMetadataKeys map[string]string
+	// TrustedProxies lists the IP addresses and CIDR ranges of proxies whose
+	// X-Forwarded-For headers are trusted when determining the client's IP
+	// address.
+	TrustedProxies []string
+	trustedProxies []*net.IPNet
+	// CreationRateLimit limits how many uploads each client may create, as the
+	// number of uploads per second. Clients are identified by their owner, see
+	// CreationRateLimitOwnerKey, or otherwise by their IP address, including
+	// the handling of TrustedProxies. Each client may create CreationRateBurst
+	// uploads at once, after which further creation requests are rejected with
+	// 429 Too Many Requests and a Retry-After header until enough time has
+	// passed. If its value is 0 or smaller, creation is not limited.
+	CreationRateLimit float64
+	// CreationRateBurst is the number of uploads a client may create at once
+	// before the CreationRateLimit applies. Defaults to 1.
+	CreationRateBurst int
+	// CreationRateLimiter keeps the state of the CreationRateLimit. Defaults to
+	// a MemoryRateLimiter, which is not shared with other instances. Requests
+	// are not limited while the rate limiter fails.
+	CreationRateLimiter RateLimiter
+	// CreationRateLimitOwnerKey is the metadata key under which the
+	// AuthorizeRequestCallback records an upload's owner. If the key is present
+	// in the metadata returned by the callback, the rate limit applies to the
+	// owner instead of the client's IP address. Values supplied by the client
+	// for this key are removed, like those of the ReservedMetadataKeys.
+	CreationRateLimitOwnerKey string
+	// CreationRateLimitExempt lists the clients, e.g. trusted internal
+	// services, to which the CreationRateLimit does not apply. Entries which
+	// are IP addresses or CIDR ranges are matched against the client's IP
+	// address, all others against the owner.
+	CreationRateLimitExempt []string
+	creationRateLimitExempt []*net.IPNet
+	// AuthorizeRequestCallback will be invoked for every POST, HEAD, PATCH, GET
+	// and DELETE request, if the property is supplied. For requests concerning
+	// an existing upload, the HookEvent contains the upload's FileInfo as stored
+	// by the data store, so the callback can compare it against the request's
+	// credentials. If an error is returned, the request is rejected. If the
+	// error is an HTTPError, its status code and body are sent to the client.
+	// For creation requests, the callback is invoked before
+	// PreUploadCreateCallback and the returned FileInfoChanges are applied to
+	// the new upload, e.g. to record its owner in the metadata. They are
+	// ignored for all other requests. When a final upload is created by
+	// concatenation, the callback is also invoked for each partial upload with
+	// the request's method set to GET, since their content becomes readable.
+	AuthorizeRequestCallback func(hook HookEvent) (FileInfoChanges, error)
+	// RequestIDHeader is the name of the request header containing the ID
+	// assigned to the request by the client or a proxy. The ID is included in
+	// the logs, echoed in the response and passed to the data store as part of
+	// the context, see RequestIDFromContext. Defaults to X-Request-ID.
+	RequestIDHeader string
+	// GenerateRequestIDs indicates whether an ID is generated for requests
+	// which do not contain the RequestIDHeader.
+	GenerateRequestIDs bool
+	// JSONErrors indicates whether error responses contain a JSON object instead
+	// of plain text. The object contains a stable, machine-readable code (e.g.
+	// ERR_OFFSET_MISMATCH), the error message and, for errors from the data
+	// store's backend implementing StoreRequestIDer, the backend's request ID.
+	JSONErrors bool
 	// PreUploadCreateCallback will be invoked before a new upload is created, if the
 	// property is supplied. If the callback returns nil, the upload will be created.
 	// Otherwise the HTTP request will be aborted. This can be used to implement
-	// validation of upload metadata etc.
-	PreUploadCreateCallback func(hook HookEvent) error
+	// validation of upload metadata etc. If the returned error is an HTTPError,
+	// its status code and body are sent to the client as they are. The returned
+	// FileInfoChanges allow the callback to modify the upload's metadata, e.g. to
+	// attach the authenticated user, before the data store sees it.
+	PreUploadCreateCallback func(hook HookEvent) (FileInfoChanges, error)
+	// RedirectDownloads indicates whether GET requests for finished uploads should
+	// be answered with a redirect to a signed URL, if the upload implements the
+	// SignableUpload interface. Uploads from other data stores are still served
+	// by the handler itself.
+	RedirectDownloads bool
+	// DownloadURLExpiry defines how long the signed URLs used for redirecting
+	// downloads are valid. Defaults to 15 minutes.
+	DownloadURLExpiry time.Duration
+	// RedirectHeadRequests indicates whether HEAD requests without the
+	// Tus-Resumable header, which therefore do not originate from tus clients,
+	// should be redirected in the same way as GET requests if RedirectDownloads
+	// is enabled.
+	RedirectHeadRequests bool
+	// DisableTermination prevents clients from terminating uploads, even if the
+	// data store supports it. The termination extension is not advertised and
+	// DELETE requests are rejected with TerminationDisabledStatusCode. Uploads
+	// can still be removed by the server, e.g. after a failed creation.
+	DisableTermination bool
+	// TerminationDisabledStatusCode is the status code used for rejecting DELETE
+	// requests if DisableTermination is set. Defaults to 405 Method Not Allowed.
+	TerminationDisabledStatusCode int
+	// ExposedStorageFields lists the entries of FileInfo.Storage which are
+	// included in the responses to HEAD and creation requests. Each entry is sent
+	// in an X-Upload-Storage-<Name> header, e.g. the entry Key in the
+	// X-Upload-Storage-Key header. Since some entries may be sensitive, none are
+	// exposed by default.
+	ExposedStorageFields []string
+	// UploadQueueTimeout enables the serialization of requests concerning the
+	// same upload within this process. Instead of being rejected, a request
+	// waits for up to this duration until the previous requests have finished.
+	// Afterwards, it is rejected with 503 Service Unavailable. A registered
+	// Locker is still used for excluding requests handled by other instances.
+	// If its value is 0 or smaller, requests do not wait.
+	UploadQueueTimeout time.Duration
+	// LockedRetryAfter is the delay suggested to clients, using the Retry-After
+	// header, after their request has been rejected because the upload is
+	// currently locked by, or busy with, another request. Defaults to 1 second.
+	LockedRetryAfter time.Duration
+	// MaxUploadDuration is the maximum duration within which an upload must be
+	// completed after its creation. Afterwards, PATCH requests for it are
+	// rejected with 410 Gone. In contrast to the expiration of the data store,
+	// which usually depends on the upload's last activity, this deadline does
+	// not move. It is only enforced for uploads whose creation time is recorded
+	// by the data store, see FileInfo.CreatedAt. If its value is 0 or smaller,
+	// uploads have no deadline.
+	MaxUploadDuration time.Duration
+	// IdempotencyKeyWindow enables the deduplication of retried creation
+	// requests using the Idempotency-Key header. If a creation request carries
+	// a key which has been used within this duration, the upload created for it
+	// is returned, including its current offset, instead of creating a new one.
+	// Requests reusing a key for an upload with a different length or metadata
+	// are rejected with 422 Unprocessable Entity. Keys only match requests by
+	// the same owner, as recorded by the AuthorizeRequestCallback under the
+	// CreationRateLimitOwnerKey, or by the same IP address for requests
+	// without an owner. The keys are kept in memory, so requests handled by
+	// other instances are not deduplicated. If its value is 0 or smaller, the
+	// header is ignored.
+	IdempotencyKeyWindow time.Duration
+	// AdminAuthorizeCallback enables the admin endpoint, which responds to GET
+	// requests for admin/uploads/:id below the BasePath with the upload's
+	// FileInfo as JSON, see UnroutedHandler.AdminGetUpload. If the data store
+	// supports holding uploads, PUT and DELETE requests for
+	// admin/uploads/:id/hold put the upload on hold and release it again. If it
+	// supports listing uploads, GET requests for admin/uploads list them, see
+	// UnroutedHandler.AdminListUploads. If it supports releasing uploads, PUT
+	// requests for admin/uploads/:id/release release them for downloads. The callback is invoked for every
+	// request to this endpoint, independently of the AuthorizeRequestCallback,
+	// and must only return nil if the request is authenticated as an
+	// administrator. If the returned error is an
+	// HTTPError, its status code and body are sent to the client. If the
+	// property is not supplied, the endpoint is not available.
+	AdminAuthorizeCallback func(r *http.Request) error
+	// SensitiveMetadataKeys lists the metadata keys whose values are redacted
+	// when uploads are inspected or listed using the admin endpoint.
+	SensitiveMetadataKeys []string
+	// SensitiveStorageKeys lists the entries of FileInfo.Storage whose values
+	// are redacted when uploads are inspected or listed using the admin
+	// endpoint, e.g. a signed URL recorded by the data store. All other entries
+	// are exposed.
+	SensitiveStorageKeys []string
+	// AdminListScanLimit is the largest number of uploads fetched from the data
+	// store for a single request listing uploads using the admin endpoint, so
+	// that filters matching few uploads do not scan the entire data store at
+	// once. If the limit is reached, the response contains the cursor for
+	// continuing the listing. Defaults to 10000.
+	AdminListScanLimit int
+	// HeldUploadStatusCode is the status code used for rejecting PATCH requests
+	// for uploads which have been put on hold, see FileInfo.OnHold. Defaults to
+	// 423 Locked.
+	HeldUploadStatusCode int
+	// DetectFiletype enables detecting the file type from the first 512 bytes
+	// of an upload's first chunk using http.DetectContentType. The result is
+	// recorded in the upload's metadata under the DetectedFiletypeKey, without
+	// changing the client-supplied filetype, so that the application can
+	// reconcile both. Clients cannot supply the DetectedFiletypeKey themselves.
+	// The data store must support updating the metadata, see
+	// MetaDataUpdaterDataStore.
+	DetectFiletype bool
+	// OverrideFiletype uses the detected file type instead of the
+	// client-supplied filetype for the Content-Type of downloads, including
+	// those redirected to the data store. Types which could not be detected are
+	// ignored. It requires DetectFiletype.
+	OverrideFiletype bool
+	// RequireRelease withholds finished uploads from downloads until they have
+	// been released, e.g. by a virus scanner which is notified about finished
+	// uploads. Until then, GET requests are rejected with
+	// UnreleasedUploadStatusCode and no signed URLs are handed out. The
+	// FileInfo of the post-finish notification reports the upload as
+	// Unreleased. Uploads are released using the admin endpoint, see
+	// UnroutedHandler.AdminReleaseDownload, or the data store's ReleaseUpload.
+	// The data store must support releasing uploads, see ReleaserDataStore.
+	RequireRelease bool
+	// UnreleasedUploadStatusCode is the status code used for rejecting downloads
+	// of uploads which have not been released yet. Defaults to 423 Locked.
+	UnreleasedUploadStatusCode int
+	// ChunkSizeBuckets are the upper bounds, in bytes, of the buckets of the
+	// histogram of chunk sizes written by PATCH requests, see
+	// Metrics.PatchChunkSizes. They must be in increasing order. Defaults to
+	// DefaultChunkSizeBuckets.
+	ChunkSizeBuckets []float64
+	// PatchDurationBuckets are the upper bounds, in seconds, of the buckets of
+	// the histogram of the time spent on PATCH requests, see
+	// Metrics.PatchDurations. They must be in increasing order. Defaults to
+	// DefaultPatchDurationBuckets.
+	PatchDurationBuckets []float64
+	// StoreName identifies the data store in the metrics of handled requests,
+	// see HandledRequest.Store. Defaults to the name of the package which
+	// implements the StoreComposer's core data store, e.g. filestore.
+	StoreName string
 	// PreFinishResponseCallback will be invoked after an upload is completed but before
 	// a response is returned to the client. Error responses from the callback will be passed
 	// back to the client. This can be used to implement post-processing validation.
@@ -56,6 +300,74 @@ func (config *Config) validate() error {
 		config.Logger = log.New(os.Stdout, "[tusd] ", log.Ldate|log.Ltime)
 	}
 
+	if config.HeldUploadStatusCode == 0 {
+		config.HeldUploadStatusCode = ErrFileLocked.StatusCode()
+	}
+
+	if config.UnreleasedUploadStatusCode == 0 {
+		config.UnreleasedUploadStatusCode = ErrFileLocked.StatusCode()
+	}
+
+	if config.DownloadURLExpiry <= 0 {
+		config.DownloadURLExpiry = 15 * time.Minute
+	}
+
+	if config.RequestIDHeader == "" {
+		config.RequestIDHeader = "X-Request-ID"
+	}
+
+	if config.AdminListScanLimit <= 0 {
+		config.AdminListScanLimit = 10000
+	}
+
+	if config.TerminationDisabledStatusCode == 0 {
+		config.TerminationDisabledStatusCode = http.StatusMethodNotAllowed
+	}
+
+	if config.LockedRetryAfter <= 0 {
+		config.LockedRetryAfter = time.Second
+	}
+
+	if len(config.ChunkSizeBuckets) == 0 {
+		config.ChunkSizeBuckets = DefaultChunkSizeBuckets
+	}
+	if !sort.Float64sAreSorted(config.ChunkSizeBuckets) {
+		return errors.New("tusd: ChunkSizeBuckets must be in increasing order")
+	}
+
+	if len(config.PatchDurationBuckets) == 0 {
+		config.PatchDurationBuckets = DefaultPatchDurationBuckets
+	}
+	if !sort.Float64sAreSorted(config.PatchDurationBuckets) {
+		return errors.New("tusd: PatchDurationBuckets must be in increasing order")
+	}
+
+	config.trustedProxies = nil
+	for _, proxy := range config.TrustedProxies {
+		network, err := parseNetwork(proxy)
+		if err != nil {
+			return fmt.Errorf("tusd: invalid trusted proxy: %s", err)
+		}
+		config.trustedProxies = append(config.trustedProxies, network)
+	}
+
+	if config.CreationRateLimit > 0 {
+		if config.CreationRateBurst <= 0 {
+			config.CreationRateBurst = 1
+		}
+		if config.CreationRateLimiter == nil {
+			config.CreationRateLimiter = NewMemoryRateLimiter()
+		}
+	}
+
+	config.creationRateLimitExempt = nil
+	for _, client := range config.CreationRateLimitExempt {
+		// Entries which are not addresses are owners
+		if network, err := parseNetwork(client); err == nil {
+			config.creationRateLimitExempt = append(config.creationRateLimitExempt, network)
+		}
+	}
+
 	base := config.BasePath
 	uri, err := url.Parse(base)
 	if err != nil {
@@ -82,5 +394,82 @@ func (config *Config) validate() error {
 		return errors.New("tusd: StoreComposer in Config needs to contain a non-nil core")
 	}
 
+	if config.StoreName == "" {
+		config.StoreName = storeName(config.StoreComposer.Core)
+	}
+
+	// The advertised extensions are derived from the composer, so it must not
+	// claim extensions for which no implementation has been registered.
+	composer := config.StoreComposer
+	if composer.UsesTerminater && composer.Terminater == nil {
+		return errors.New("tusd: StoreComposer in Config uses a terminater but contains a nil Terminater")
+	}
+	if composer.UsesLocker && composer.Locker == nil {
+		return errors.New("tusd: StoreComposer in Config uses a locker but contains a nil Locker")
+	}
+	if composer.UsesConcater && composer.Concater == nil {
+		return errors.New("tusd: StoreComposer in Config uses a concater but contains a nil Concater")
+	}
+	if composer.UsesLengthDeferrer && composer.LengthDeferrer == nil {
+		return errors.New("tusd: StoreComposer in Config uses a length deferrer but contains a nil LengthDeferrer")
+	}
+	if composer.UsesExpirer && composer.Expirer == nil {
+		return errors.New("tusd: StoreComposer in Config uses an expirer but contains a nil Expirer")
+	}
+	if composer.UsesTruncater && composer.Truncater == nil {
+		return errors.New("tusd: StoreComposer in Config uses a truncater but contains a nil Truncater")
+	}
+	if composer.UsesHolder && composer.Holder == nil {
+		return errors.New("tusd: StoreComposer in Config uses a holder but contains a nil Holder")
+	}
+	if composer.UsesLister && composer.Lister == nil {
+		return errors.New("tusd: StoreComposer in Config uses a lister but contains a nil Lister")
+	}
+	if composer.UsesMetaDataUpdater && composer.MetaDataUpdater == nil {
+		return errors.New("tusd: StoreComposer in Config uses a metadata updater but contains a nil MetaDataUpdater")
+	}
+
+	if composer.UsesReleaser && composer.Releaser == nil {
+		return errors.New("tusd: StoreComposer in Config uses a releaser but contains a nil Releaser")
+	}
+
+	if config.RequireRelease && !composer.UsesReleaser {
+		return errors.New("tusd: RequireRelease requires a StoreComposer with a Releaser")
+	}
+	if config.DetectFiletype && !composer.UsesMetaDataUpdater {
+		return errors.New("tusd: DetectFiletype requires a StoreComposer with a MetaDataUpdater")
+	}
+	if config.OverrideFiletype && !config.DetectFiletype {
+		return errors.New("tusd: OverrideFiletype requires DetectFiletype")
+	}
+
 	return nil
 }
+
+// storeName returns the name of the package which implements the data store.
+func storeName(store DataStore) string {
+	t := reflect.TypeOf(store)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == "" {
+		return "unknown"
+	}
+
+	return path.Base(t.PkgPath())
+}
+
+// parseNetwork parses an IP address or CIDR range. A single address results
+// in a range containing only this address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		if strings.Contains(value, ":") {
+			value += "/128"
+		} else {
+			value += "/32"
+		}
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
@@ -42,3 +42,54 @@ func TestConfigEmptyCore(t *testing.T) {
 
 	a.Error(config.validate())
 }
+
+func TestConfigInconsistentComposer(t *testing.T) {
+	a := assert.New(t)
+
+	composer := NewStoreComposer()
+	composer.UseCore(zeroStore{})
+	composer.UsesTerminater = true
+
+	config := Config{
+		StoreComposer: composer,
+	}
+
+	a.Error(config.validate())
+}
+
+func TestConfigDetectFiletype(t *testing.T) {
+	a := assert.New(t)
+
+	composer := NewStoreComposer()
+	composer.UseCore(zeroStore{})
+
+	config := Config{
+		StoreComposer:  composer,
+		DetectFiletype: true,
+	}
+	a.EqualError(config.validate(), "tusd: DetectFiletype requires a StoreComposer with a MetaDataUpdater")
+
+	config = Config{
+		StoreComposer:    composer,
+		OverrideFiletype: true,
+	}
+	a.EqualError(config.validate(), "tusd: OverrideFiletype requires DetectFiletype")
+}
+
+func TestConfigTrustedProxies(t *testing.T) {
+	a := assert.New(t)
+
+	composer := NewStoreComposer()
+	composer.UseCore(zeroStore{})
+
+	config := Config{
+		StoreComposer:  composer,
+		TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5", "::1"},
+	}
+
+	a.Nil(config.validate())
+	a.Len(config.trustedProxies, 3)
+
+	config.TrustedProxies = []string{"not-an-ip"}
+	a.Error(config.validate())
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"io"
+	"time"
 )
 
 type MetaData map[string]string
@@ -30,6 +31,18 @@ type FileInfo struct {
 	// for example a file path. The available values vary depending on what data
 	// store is used. This map may also be nil.
 	Storage map[string]string
+	// CreatedAt is the point in time at which the upload has been created, as
+	// recorded by the data store. It is nil if the data store does not record
+	// it. See Config.MaxUploadDuration.
+	CreatedAt *time.Time `json:",omitempty"`
+	// OnHold indicates that the upload has been put on hold by the server, e.g.
+	// for moderation. While it is on hold, no data can be appended to it. See
+	// HolderDataStore.
+	OnHold bool `json:",omitempty"`
+	// Unreleased indicates that the finished upload is withheld from downloads
+	// until it has been released, e.g. after passing a virus scan. See
+	// Config.RequireRelease and ReleaserDataStore.
+	Unreleased bool `json:",omitempty"`
 
 	// stopUpload is the cancel function for the upload's context.Context. When
 	// invoked it will interrupt the writes to DataStore#WriteChunk.
@@ -78,6 +91,18 @@ type Upload interface {
 	FinishUpload(ctx context.Context) error
 }
 
+// SignableUpload is the interface which may be implemented by uploads whose
+// data store is able to hand out URLs granting temporary read access to the
+// upload's content, such as pre-signed URLs for cloud storages. If the
+// RedirectDownloads option is enabled, the handler will redirect downloads of
+// such uploads to these URLs instead of serving the content itself.
+type SignableUpload interface {
+	// SignURL returns a URL from which the upload's content can be downloaded
+	// until the expiry duration has passed. Responses for this URL should carry
+	// the provided values for the Content-Type and Content-Disposition headers.
+	SignURL(ctx context.Context, expiry time.Duration, contentType string, contentDisposition string) (string, error)
+}
+
 type DataStore interface {
 	// Create a new upload using the size as the file's length. The method must
 	// return an unique id which is used to identify the upload. If no backend
@@ -130,6 +155,81 @@ type LengthDeclarableUpload interface {
 	DeclareLength(ctx context.Context, length int64) error
 }
 
+// ExpirerDataStore is the interface required to be implemented if the
+// Expiration extension should be enabled. Only in this case, the handler will
+// include the Upload-Expires header in its responses and reject requests to
+// resume uploads which have expired.
+type ExpirerDataStore interface {
+	AsExpirableUpload(upload Upload) ExpirableUpload
+}
+
+type ExpirableUpload interface {
+	// ExpiresAt returns the point in time after which the upload can no longer
+	// be resumed. A zero time.Time indicates that the upload does not expire.
+	ExpiresAt(ctx context.Context) (time.Time, error)
+}
+
+// TruncaterDataStore is the interface required to be implemented if the
+// Checksum extension should be enabled. Since the handler can only verify a
+// chunk's checksum after it has been written, the data store must be able to
+// remove the chunk again if it does not match.
+type TruncaterDataStore interface {
+	AsTruncatableUpload(upload Upload) TruncatableUpload
+}
+
+type TruncatableUpload interface {
+	// Truncate removes all data stored at or after the given offset, so that
+	// the upload's offset is reset to it.
+	Truncate(ctx context.Context, offset int64) error
+}
+
+// HolderDataStore is the interface required to be implemented if uploads
+// should be put on hold and released again using the admin endpoint. The data
+// store must persist the state, so that it is reported in FileInfo.OnHold.
+type HolderDataStore interface {
+	AsHoldableUpload(upload Upload) HoldableUpload
+}
+
+type HoldableUpload interface {
+	// SetOnHold puts the upload on hold or releases it again.
+	SetOnHold(ctx context.Context, onHold bool) error
+}
+
+// ReleaserDataStore is the interface required to be implemented if downloads
+// should be gated behind a release, see Config.RequireRelease. The data store
+// must persist the state, so that it is reported in FileInfo.Unreleased.
+type ReleaserDataStore interface {
+	// WithholdUpload marks the upload as unreleased. It is invoked right before
+	// the upload is finished, so that it cannot be downloaded at any time
+	// before its release.
+	WithholdUpload(ctx context.Context, id string) error
+	// ReleaseUpload allows the upload to be downloaded.
+	ReleaseUpload(ctx context.Context, id string) error
+}
+
+// MetaDataUpdaterDataStore is the interface required to be implemented if the
+// handler should record information in an upload's metadata after its
+// creation, e.g. the detected file type, see Config.DetectFiletype.
+type MetaDataUpdaterDataStore interface {
+	AsMetaDataUpdatableUpload(upload Upload) MetaDataUpdatableUpload
+}
+
+type MetaDataUpdatableUpload interface {
+	// SetMetaData replaces the upload's metadata.
+	SetMetaData(ctx context.Context, meta MetaData) error
+}
+
+// ListerDataStore is the interface required to be implemented if uploads
+// should be listed using the admin endpoint.
+type ListerDataStore interface {
+	// ListUploads returns the information about up to limit uploads, whose IDs
+	// sort after the given one, ordered by their IDs. An empty ID starts the
+	// listing at the beginning. If fewer than limit uploads are returned, there
+	// are no more uploads. A single request to the admin endpoint calls it until
+	// Config.AdminListScanLimit uploads have been returned.
+	ListUploads(ctx context.Context, after string, limit int) ([]FileInfo, error)
+}
+
 // Locker is the interface required for custom lock persisting mechanisms.
 // Common ways to store this information is in memory, on disk or using an
 // external service, such as Redis.
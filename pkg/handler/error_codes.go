@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ErrorCoder may be implemented by errors to provide a stable,
+// machine-readable code, which is included in JSON error responses, see
+// Config.JSONErrors. Errors without a code are identified by one derived from
+// their status code, e.g. ERR_INTERNAL_SERVER_ERROR.
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// StoreRequestIDer may be implemented by errors originating from a data
+// store's backend to expose the ID the backend assigned to the failed request.
+// It is included in JSON error responses to help with correlating failures.
+type StoreRequestIDer interface {
+	StoreRequestID() string
+}
+
+// codedError attaches an error code to an HTTPError whose message is not
+// fixed, so that it cannot be looked up in errorCodes.
+type codedError struct {
+	HTTPError
+	code string
+}
+
+func (err codedError) ErrorCode() string {
+	return err.code
+}
+
+// errorCodes maps the errors returned by the handler to their codes.
+var errorCodes = map[error]string{
+	ErrUnsupportedVersion:               "ERR_UNSUPPORTED_VERSION",
+	ErrMaxSizeExceeded:                  "ERR_MAX_SIZE_EXCEEDED",
+	ErrInvalidContentType:               "ERR_INVALID_CONTENT_TYPE",
+	ErrInvalidUploadLength:              "ERR_INVALID_UPLOAD_LENGTH",
+	ErrInvalidOffset:                    "ERR_INVALID_OFFSET",
+	ErrNotFound:                         "ERR_UPLOAD_NOT_FOUND",
+	ErrFileLocked:                       "ERR_UPLOAD_LOCKED",
+	ErrMismatchOffset:                   "ERR_OFFSET_MISMATCH",
+	ErrSizeExceeded:                     "ERR_UPLOAD_SIZE_EXCEEDED",
+	ErrNotImplemented:                   "ERR_NOT_IMPLEMENTED",
+	ErrUploadNotFinished:                "ERR_PARTIAL_UPLOAD_NOT_FINISHED",
+	ErrInvalidConcat:                    "ERR_INVALID_CONCAT",
+	ErrModifyFinal:                      "ERR_MODIFY_FINAL_UPLOAD",
+	ErrUploadLengthAndUploadDeferLength: "ERR_AMBIGUOUS_UPLOAD_LENGTH",
+	ErrInvalidUploadDeferLength:         "ERR_INVALID_UPLOAD_DEFER_LENGTH",
+	ErrUploadStoppedByServer:            "ERR_UPLOAD_STOPPED",
+	ErrIncompleteUpload:                 "ERR_UPLOAD_INCOMPLETE",
+	ErrRangeNotSatisfiable:              "ERR_RANGE_NOT_SATISFIABLE",
+	ErrUploadExpired:                    "ERR_UPLOAD_EXPIRED",
+	ErrUploadBusy:                       "ERR_UPLOAD_BUSY",
+	ErrIncompleteBody:                   "ERR_INCOMPLETE_BODY",
+	ErrUploadDeadlineExceeded:           "ERR_UPLOAD_DEADLINE_EXCEEDED",
+	ErrUnsupportedChecksumAlgorithm:     "ERR_UNSUPPORTED_CHECKSUM_ALGORITHM",
+	ErrInvalidChecksum:                  "ERR_INVALID_CHECKSUM",
+	ErrChecksumMismatch:                 "ERR_CHECKSUM_MISMATCH",
+	ErrChecksumChunkTooLarge:            "ERR_CHECKSUM_CHUNK_TOO_LARGE",
+	ErrIdempotencyKeyMismatch:           "ERR_IDEMPOTENCY_KEY_MISMATCH",
+	ErrIdempotencyKeyInUse:              "ERR_IDEMPOTENCY_KEY_IN_USE",
+	ErrInvalidListQuery:                 "ERR_INVALID_LIST_QUERY",
+	ErrRateLimited:                      "ERR_RATE_LIMITED",
+	errReadTimeout:                      "ERR_READ_TIMEOUT",
+	errConnectionReset:                  "ERR_CONNECTION_RESET",
+}
+
+// errorCode returns the code identifying the error in JSON error responses.
+func errorCode(err error, statusCode int) string {
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		return coder.ErrorCode()
+	}
+
+	// Errors of uncomparable types cannot be used as map keys
+	if reflect.TypeOf(err).Comparable() {
+		if code, ok := errorCodes[err]; ok {
+			return code
+		}
+	}
+
+	text := http.StatusText(statusCode)
+	if text == "" {
+		return "ERR_UNKNOWN"
+	}
+
+	return "ERR_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(text))
+}
+
+// jsonError is the body of JSON error responses.
+type jsonError struct {
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+	StoreRequestID string `json:"storeRequestId,omitempty"`
+}
+
+// jsonErrorBody serializes the error for a JSON error response.
+func jsonErrorBody(err error, statusErr HTTPError) []byte {
+	body := jsonError{
+		Code:    errorCode(err, statusErr.StatusCode()),
+		Message: string(statusErr.Body()),
+	}
+
+	var ider StoreRequestIDer
+	if errors.As(err, &ider) {
+		body.StoreRequestID = ider.StoreRequestID()
+	}
+
+	// Marshalling a struct of strings cannot fail
+	result, _ := json.Marshal(body)
+	return append(result, '\n')
+}
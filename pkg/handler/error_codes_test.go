@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type uncomparableError []string
+
+func (err uncomparableError) Error() string {
+	return "uncomparable"
+}
+
+type storeError struct {
+	requestID string
+}
+
+func (err storeError) Error() string {
+	return "backend failed"
+}
+
+func (err storeError) StoreRequestID() string {
+	return err.requestID
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err        error
+		statusCode int
+		code       string
+	}{
+		{ErrMismatchOffset, http.StatusConflict, "ERR_OFFSET_MISMATCH"},
+		{ErrUploadExpired, http.StatusGone, "ERR_UPLOAD_EXPIRED"},
+		{ErrNotFound, http.StatusNotFound, "ERR_UPLOAD_NOT_FOUND"},
+		{ErrFileLocked, 423, "ERR_UPLOAD_LOCKED"},
+		{ErrIncompleteBody, http.StatusBadRequest, "ERR_INCOMPLETE_BODY"},
+		{errReadTimeout, http.StatusInternalServerError, "ERR_READ_TIMEOUT"},
+		{codedError{NewHTTPError(errors.New("bad key"), http.StatusBadRequest), "ERR_INVALID_METADATA"}, http.StatusBadRequest, "ERR_INVALID_METADATA"},
+		{fmt.Errorf("wrapped: %w", codedError{ErrNotFound, "ERR_CUSTOM"}), http.StatusNotFound, "ERR_CUSTOM"},
+		{NewHTTPError(errors.New("custom"), http.StatusTeapot), http.StatusTeapot, "ERR_I_M_A_TEAPOT"},
+		{errors.New("unknown"), http.StatusInternalServerError, "ERR_INTERNAL_SERVER_ERROR"},
+		{uncomparableError{"a"}, http.StatusInternalServerError, "ERR_INTERNAL_SERVER_ERROR"},
+		{errors.New("unknown"), 599, "ERR_UNKNOWN"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.code, errorCode(test.err, test.statusCode), test.err.Error())
+	}
+
+	// Codes must be unique to tell the errors apart
+	seen := make(map[string]bool, len(errorCodes))
+	for err, code := range errorCodes {
+		assert.False(t, seen[code], err.Error())
+		seen[code] = true
+	}
+}
+
+func TestJSONErrorBody(t *testing.T) {
+	a := assert.New(t)
+
+	body := jsonErrorBody(ErrMismatchOffset, ErrMismatchOffset)
+	a.Equal(`{"code":"ERR_OFFSET_MISMATCH","message":"mismatched offset"}`+"\n", string(body))
+
+	err := fmt.Errorf("s3store: %w", storeError{"req-123"})
+	body = jsonErrorBody(err, NewHTTPError(err, http.StatusInternalServerError))
+	a.Equal(`{"code":"ERR_INTERNAL_SERVER_ERROR","message":"s3store: backend failed","storeRequestId":"req-123"}`+"\n", string(body))
+}
+
+func TestSendErrorRetryAfter(t *testing.T) {
+	composer := NewStoreComposer()
+	composer.UseCore(zeroStore{})
+	handler, err := NewUnroutedHandler(Config{
+		StoreComposer: composer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		err        error
+		retryAfter string
+	}{
+		{ErrFileLocked, "1"},
+		{handler.uploadOnHoldError(), ""},
+		{handler.uploadUnreleasedError(), ""},
+		// The errors are recognized by their codes, not by their messages
+		{codedError{NewHTTPError(errors.New("upload is on hold for review"), http.StatusLocked), errCodeUploadOnHold}, ""},
+		{codedError{NewHTTPError(errors.New("upload is being scanned"), http.StatusLocked), errCodeUploadUnreleased}, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.sendError(w, httptest.NewRequest("PATCH", "/files/yes", nil), test.err)
+		assert.Equal(t, http.StatusLocked, w.Code, test.err.Error())
+		assert.Equal(t, test.retryAfter, w.Header().Get("Retry-After"), test.err.Error())
+	}
+}
@@ -0,0 +1,408 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+func TestExpiration(t *testing.T) {
+	now := time.Date(2030, time.March, 4, 5, 6, 7, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	SubTest(t, "ExtensionDiscovery", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer = NewStoreComposer()
+		composer.UseCore(store)
+		composer.UseExpirer(store)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Tus-Extension": "creation,creation-with-upload,expiration",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Post", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(context.Background(), FileInfo{
+				Size:     300,
+				MetaData: map[string]string{},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(time.Date(2030, time.March, 4, 5, 6, 7, 0, time.UTC), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location":       "http://tus.io/files/foo",
+				"Upload-Expires": "Mon, 04 Mar 2030 05:06:07 GMT",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Head", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(time.Date(2030, time.March, 4, 6, 6, 7, 0, time.FixedZone("CET", 3600)), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset":  "5",
+				"Upload-Expires": "Mon, 04 Mar 2030 05:06:07 GMT",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "HeadWithoutExpiry", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   10,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(time.Time{}, nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Expires": "",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Patch", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		expiresAt := time.Now().Add(time.Hour).UTC()
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(expiresAt, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset":  "10",
+				"Upload-Expires": expiresAt.Format(http.TimeFormat),
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchExpired", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(now.Add(-time.Hour), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+		handler.SetNow(clock)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusGone,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchDeadlineExceeded", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		createdAt := now.Add(-2 * time.Hour)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				CreatedAt: &createdAt,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			// The upload has been active recently, so it did not expire
+			upload.EXPECT().ExpiresAt(context.Background()).Return(now.Add(time.Hour), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			MaxUploadDuration: time.Hour,
+		})
+		handler.SetNow(clock)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusGone,
+			ResBody: "upload has not been completed in time\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchExpiredBeforeDeadline", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		createdAt := now.Add(-2 * time.Hour)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				CreatedAt: &createdAt,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(now.Add(-time.Minute), nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			MaxUploadDuration: 24 * time.Hour,
+		})
+		handler.SetNow(clock)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusGone,
+			ResBody: "upload has expired\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchWithinDeadline", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		createdAt := now.Add(-time.Minute)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				CreatedAt: &createdAt,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			MaxUploadDuration: time.Hour,
+		})
+		handler.SetNow(clock)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "10",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchAtDeadline", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		createdAt := now.Add(-time.Hour)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:        "yes",
+				Offset:    5,
+				Size:      20,
+				CreatedAt: &createdAt,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			MaxUploadDuration: time.Hour,
+		})
+		handler.SetNow(clock)
+
+		// The deadline is exceeded from the instant it is reached
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusGone,
+			ResBody: "upload has not been completed in time\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchAtExpiry", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			store.EXPECT().AsExpirableUpload(upload).Return(upload),
+			upload.EXPECT().ExpiresAt(context.Background()).Return(now, nil),
+		)
+
+		composer.UseExpirer(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+		handler.SetNow(clock)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusGone,
+			ResBody: "upload has expired\n",
+		}).Run(handler, t)
+	})
+}
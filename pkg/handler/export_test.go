@@ -0,0 +1,14 @@
+package handler
+
+import "time"
+
+// SetNow replaces the clock against which the handler checks expiry and
+// deadlines.
+func (handler *UnroutedHandler) SetNow(now func() time.Time) {
+	handler.now = now
+}
+
+// SetNow replaces the clock against which the limiter refills its buckets.
+func (limiter *MemoryRateLimiter) SetNow(now func() time.Time) {
+	limiter.now = now
+}
@@ -3,10 +3,13 @@ package handler_test
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
 	. "github.com/tus/tusd/pkg/handler"
 )
 
@@ -20,6 +23,22 @@ func (reader *closingStringReader) Close() error {
 	return nil
 }
 
+// signableUpload extends the mocked upload with the SignableUpload interface.
+type signableUpload struct {
+	*MockFullUpload
+
+	expiry             time.Duration
+	contentType        string
+	contentDisposition string
+}
+
+func (upload *signableUpload) SignURL(ctx context.Context, expiry time.Duration, contentType string, contentDisposition string) (string, error) {
+	upload.expiry = expiry
+	upload.contentType = contentType
+	upload.contentDisposition = contentDisposition
+	return "https://bucket.example.com/yes?signature=abc", nil
+}
+
 func TestGet(t *testing.T) {
 	SubTest(t, "Download", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		reader := &closingStringReader{
@@ -37,8 +56,9 @@ func TestGet(t *testing.T) {
 			lock.EXPECT().Lock().Return(nil),
 			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
 			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
 				Offset: 5,
-				Size:   20,
+				Size:   5,
 				MetaData: map[string]string{
 					"filename": "file.jpg\"evil",
 					"filetype": "image/jpeg",
@@ -63,6 +83,8 @@ func TestGet(t *testing.T) {
 				"Content-Length":      "5",
 				"Content-Type":        "image/jpeg",
 				"Content-Disposition": `inline;filename="file.jpg\"evil"`,
+				"Accept-Ranges":       "bytes",
+				"ETag":                `"796573-5"`,
 			},
 			Code:    http.StatusOK,
 			ResBody: "hello",
@@ -165,4 +187,261 @@ func TestGet(t *testing.T) {
 			ResBody: "",
 		}).Run(handler, t)
 	})
+	SubTest(t, "Range", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		tests := []struct {
+			name         string
+			rangeHeader  string
+			code         int
+			body         string
+			contentRange string
+		}{
+			{"Bounded", "bytes=1-3", http.StatusPartialContent, "ell", "bytes 1-3/5"},
+			{"OpenEnded", "bytes=2-", http.StatusPartialContent, "llo", "bytes 2-4/5"},
+			{"Suffix", "bytes=-2", http.StatusPartialContent, "lo", "bytes 3-4/5"},
+			{"EndBeyondSize", "bytes=3-100", http.StatusPartialContent, "lo", "bytes 3-4/5"},
+			{"MultipleRanges", "bytes=0-1,3-4", http.StatusOK, "hello", ""},
+			{"Malformed", "bytes=a-b", http.StatusOK, "hello", ""},
+		}
+
+		for _, test := range tests {
+			test := test
+			SubTest(t, test.name, func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+				upload := NewMockFullUpload(ctrl)
+
+				gomock.InOrder(
+					store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+					upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+						ID:     "yes",
+						Offset: 5,
+						Size:   5,
+					}, nil),
+					upload.EXPECT().GetReader(context.Background()).Return(&closingStringReader{
+						Reader: strings.NewReader("hello"),
+					}, nil),
+				)
+
+				handler, _ := NewHandler(Config{
+					StoreComposer: composer,
+				})
+
+				(&httpTest{
+					Method: "GET",
+					URL:    "yes",
+					ReqHeader: map[string]string{
+						"Range": test.rangeHeader,
+					},
+					ResHeader: map[string]string{
+						"Content-Length": strconv.Itoa(len(test.body)),
+						"Content-Range":  test.contentRange,
+					},
+					Code:    test.code,
+					ResBody: test.body,
+				}).Run(handler, t)
+			})
+		}
+	})
+
+	SubTest(t, "RangeNotSatisfiable", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Range": "bytes=5-",
+			},
+			ResHeader: map[string]string{
+				"Content-Range": "bytes */5",
+			},
+			Code: http.StatusRequestedRangeNotSatisfiable,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotModified", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"If-None-Match": `"other", W/"796573-5"`,
+			},
+			ResHeader: map[string]string{
+				"ETag": `"796573-5"`,
+			},
+			Code:    http.StatusNotModified,
+			ResBody: "",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "IncompleteUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusConflict,
+			ResBody: "upload has not been finished yet\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UploadNotFoundFail", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(context.Background(), "no").Return(nil, ErrNotFound)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "no",
+			Code:   http.StatusNotFound,
+		}).Run(handler, t)
+	})
+	SubTest(t, "Redirect", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := &signableUpload{MockFullUpload: NewMockFullUpload(ctrl)}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+				MetaData: map[string]string{
+					"filename": "image.png",
+					"filetype": "image/png",
+				},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			RedirectDownloads: true,
+			DownloadURLExpiry: time.Minute,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Location":      "https://bucket.example.com/yes?signature=abc",
+				"Cache-Control": "no-store",
+			},
+			Code: http.StatusFound,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal(time.Minute, upload.expiry)
+		a.Equal("image/png", upload.contentType)
+		a.Equal(`inline;filename="image.png"`, upload.contentDisposition)
+	})
+
+	SubTest(t, "RedirectFallback", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().GetReader(context.Background()).Return(strings.NewReader("hello"), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			RedirectDownloads: true,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Location": "",
+			},
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "RedirectIncompleteUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := &signableUpload{MockFullUpload: NewMockFullUpload(ctrl)}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 2,
+				Size:   5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:     composer,
+			RedirectDownloads: true,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Location": "",
+			},
+			Code: http.StatusConflict,
+		}).Run(handler, t)
+	})
 }
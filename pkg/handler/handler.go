@@ -42,6 +42,24 @@ func NewHandler(config Config) (*Handler, error) {
 	mux.Add("PATCH", ":id", http.HandlerFunc(handler.PatchFile))
 	mux.Get(":id", http.HandlerFunc(handler.GetFile))
 
+	// Only attach the admin endpoint if it has been explicitly configured
+	if config.AdminAuthorizeCallback != nil {
+		mux.Get("admin/uploads/:id", http.HandlerFunc(handler.AdminGetUpload))
+
+		if config.StoreComposer.UsesLister {
+			mux.Get("admin/uploads", http.HandlerFunc(handler.AdminListUploads))
+		}
+
+		if config.StoreComposer.UsesHolder {
+			mux.Put("admin/uploads/:id/hold", http.HandlerFunc(handler.AdminHoldUpload))
+			mux.Del("admin/uploads/:id/hold", http.HandlerFunc(handler.AdminReleaseUpload))
+		}
+
+		if config.StoreComposer.UsesReleaser {
+			mux.Put("admin/uploads/:id/release", http.HandlerFunc(handler.AdminReleaseDownload))
+		}
+	}
+
 	// Only attach the DELETE handler if the Terminate() method is provided
 	if config.StoreComposer.UsesTerminater {
 		mux.Del(":id", http.HandlerFunc(handler.DelFile))
@@ -10,6 +10,7 @@ import (
 	handler "github.com/tus/tusd/pkg/handler"
 	io "io"
 	reflect "reflect"
+	time "time"
 )
 
 // MockFullDataStore is a mock of FullDataStore interface
@@ -107,6 +108,105 @@ func (mr *MockFullDataStoreMockRecorder) AsLengthDeclarableUpload(upload interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsLengthDeclarableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsLengthDeclarableUpload), upload)
 }
 
+// AsExpirableUpload mocks base method
+func (m *MockFullDataStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsExpirableUpload", upload)
+	ret0, _ := ret[0].(handler.ExpirableUpload)
+	return ret0
+}
+
+// AsExpirableUpload indicates an expected call of AsExpirableUpload
+func (mr *MockFullDataStoreMockRecorder) AsExpirableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsExpirableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsExpirableUpload), upload)
+}
+
+// AsTruncatableUpload mocks base method
+func (m *MockFullDataStore) AsTruncatableUpload(upload handler.Upload) handler.TruncatableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsTruncatableUpload", upload)
+	ret0, _ := ret[0].(handler.TruncatableUpload)
+	return ret0
+}
+
+// AsTruncatableUpload indicates an expected call of AsTruncatableUpload
+func (mr *MockFullDataStoreMockRecorder) AsTruncatableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsTruncatableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsTruncatableUpload), upload)
+}
+
+// AsHoldableUpload mocks base method
+func (m *MockFullDataStore) AsHoldableUpload(upload handler.Upload) handler.HoldableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsHoldableUpload", upload)
+	ret0, _ := ret[0].(handler.HoldableUpload)
+	return ret0
+}
+
+// AsHoldableUpload indicates an expected call of AsHoldableUpload
+func (mr *MockFullDataStoreMockRecorder) AsHoldableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsHoldableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsHoldableUpload), upload)
+}
+
+// ListUploads mocks base method
+func (m *MockFullDataStore) ListUploads(ctx context.Context, after string, limit int) ([]handler.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUploads", ctx, after, limit)
+	ret0, _ := ret[0].([]handler.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUploads indicates an expected call of ListUploads
+func (mr *MockFullDataStoreMockRecorder) ListUploads(ctx, after, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUploads", reflect.TypeOf((*MockFullDataStore)(nil).ListUploads), ctx, after, limit)
+}
+
+// WithholdUpload mocks base method
+func (m *MockFullDataStore) WithholdUpload(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithholdUpload", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WithholdUpload indicates an expected call of WithholdUpload
+func (mr *MockFullDataStoreMockRecorder) WithholdUpload(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithholdUpload", reflect.TypeOf((*MockFullDataStore)(nil).WithholdUpload), ctx, id)
+}
+
+// ReleaseUpload mocks base method
+func (m *MockFullDataStore) ReleaseUpload(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseUpload", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseUpload indicates an expected call of ReleaseUpload
+func (mr *MockFullDataStoreMockRecorder) ReleaseUpload(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseUpload", reflect.TypeOf((*MockFullDataStore)(nil).ReleaseUpload), ctx, id)
+}
+
+// AsMetaDataUpdatableUpload mocks base method
+func (m *MockFullDataStore) AsMetaDataUpdatableUpload(upload handler.Upload) handler.MetaDataUpdatableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsMetaDataUpdatableUpload", upload)
+	ret0, _ := ret[0].(handler.MetaDataUpdatableUpload)
+	return ret0
+}
+
+// AsMetaDataUpdatableUpload indicates an expected call of AsMetaDataUpdatableUpload
+func (mr *MockFullDataStoreMockRecorder) AsMetaDataUpdatableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsMetaDataUpdatableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsMetaDataUpdatableUpload), upload)
+}
+
 // MockFullUpload is a mock of FullUpload interface
 type MockFullUpload struct {
 	ctrl     *gomock.Controller
@@ -231,6 +331,63 @@ func (mr *MockFullUploadMockRecorder) ConcatUploads(ctx, partialUploads interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConcatUploads", reflect.TypeOf((*MockFullUpload)(nil).ConcatUploads), ctx, partialUploads)
 }
 
+// ExpiresAt mocks base method
+func (m *MockFullUpload) ExpiresAt(ctx context.Context) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpiresAt", ctx)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpiresAt indicates an expected call of ExpiresAt
+func (mr *MockFullUploadMockRecorder) ExpiresAt(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpiresAt", reflect.TypeOf((*MockFullUpload)(nil).ExpiresAt), ctx)
+}
+
+// Truncate mocks base method
+func (m *MockFullUpload) Truncate(ctx context.Context, offset int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Truncate", ctx, offset)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Truncate indicates an expected call of Truncate
+func (mr *MockFullUploadMockRecorder) Truncate(ctx, offset interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Truncate", reflect.TypeOf((*MockFullUpload)(nil).Truncate), ctx, offset)
+}
+
+// SetOnHold mocks base method
+func (m *MockFullUpload) SetOnHold(ctx context.Context, onHold bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetOnHold", ctx, onHold)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetOnHold indicates an expected call of SetOnHold
+func (mr *MockFullUploadMockRecorder) SetOnHold(ctx, onHold interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOnHold", reflect.TypeOf((*MockFullUpload)(nil).SetOnHold), ctx, onHold)
+}
+
+// SetMetaData mocks base method
+func (m *MockFullUpload) SetMetaData(ctx context.Context, meta handler.MetaData) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetMetaData", ctx, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetMetaData indicates an expected call of SetMetaData
+func (mr *MockFullUploadMockRecorder) SetMetaData(ctx, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMetaData", reflect.TypeOf((*MockFullUpload)(nil).SetMetaData), ctx, meta)
+}
+
 // MockFullLocker is a mock of FullLocker interface
 type MockFullLocker struct {
 	ctrl     *gomock.Controller
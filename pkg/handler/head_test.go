@@ -146,4 +146,104 @@ func TestHead(t *testing.T) {
 			},
 		}).Run(handler, t)
 	})
+	SubTest(t, "Redirect", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := &signableUpload{MockFullUpload: NewMockFullUpload(ctrl)}
+
+		store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+			ID:     "yes",
+			Offset: 5,
+			Size:   5,
+		}, nil).Times(2)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			RedirectDownloads:    true,
+			RedirectHeadRequests: true,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			Code:   http.StatusFound,
+			ResHeader: map[string]string{
+				"Location": "https://bucket.example.com/yes?signature=abc",
+			},
+		}).Run(handler, t)
+
+		// Requests from tus clients must not be redirected
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Location":      "",
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "ExposedStorageFields", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		storage := map[string]string{
+			"Type":      "s3store",
+			"Bucket":    "my-bucket",
+			"Key":       "yes",
+			"SignedURL": "https://my-bucket.example.com/yes?signature=abc",
+		}
+
+		store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+			ID:      "yes",
+			Offset:  5,
+			Size:    10,
+			Storage: storage,
+		}, nil).Times(2)
+
+		// No storage details are exposed by default
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"X-Upload-Storage-Key":    "",
+				"X-Upload-Storage-Bucket": "",
+			},
+		}).Run(handler, t)
+
+		handler, _ = NewHandler(Config{
+			StoreComposer:        composer,
+			ExposedStorageFields: []string{"Bucket", "Key"},
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"X-Upload-Storage-Key":       "yes",
+				"X-Upload-Storage-Bucket":    "my-bucket",
+				"X-Upload-Storage-Type":      "",
+				"X-Upload-Storage-Signedurl": "",
+			},
+		}).Run(handler, t)
+	})
 }
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// idempotencyIndex remembers which upload has been created for an
+// Idempotency-Key, so that retried creation requests do not result in
+// additional uploads. Keys are forgotten once the window has passed. The index
+// is kept in memory and therefore only deduplicates requests handled by this
+// process.
+type idempotencyIndex struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	entries map[string]*idempotencyEntry
+	// order contains the entries in the order of their creation, so that the
+	// expired ones can be removed without iterating over the entire map.
+	order []*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	key string
+	// fingerprint describes the creation request, see idempotencyFingerprint.
+	fingerprint string
+	// uploadID is the ID of the created upload. It is empty while the creation
+	// is still in progress.
+	uploadID  string
+	createdAt time.Time
+}
+
+func newIdempotencyIndex(window time.Duration) *idempotencyIndex {
+	return &idempotencyIndex{
+		window:  window,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// reserve looks up the upload created for the key. If the key has not been
+// seen within the window before now, it is reserved for the calling request,
+// which must either commit or release it afterwards, and an empty ID is
+// returned.
+func (index *idempotencyIndex) reserve(key string, fingerprint string, now time.Time) (string, error) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.prune(now)
+
+	if entry, ok := index.entries[key]; ok {
+		if entry.fingerprint != fingerprint {
+			return "", ErrIdempotencyKeyMismatch
+		}
+		if entry.uploadID == "" {
+			return "", ErrIdempotencyKeyInUse
+		}
+		return entry.uploadID, nil
+	}
+
+	entry := &idempotencyEntry{
+		key:         key,
+		fingerprint: fingerprint,
+		createdAt:   now,
+	}
+	index.entries[key] = entry
+	index.order = append(index.order, entry)
+
+	return "", nil
+}
+
+// commit records the upload created for a reserved key.
+func (index *idempotencyIndex) commit(key string, uploadID string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if entry, ok := index.entries[key]; ok {
+		entry.uploadID = uploadID
+	}
+}
+
+// release removes the reservation of a key if no upload has been committed
+// for it, e.g. because the creation failed.
+func (index *idempotencyIndex) release(key string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if entry, ok := index.entries[key]; ok && entry.uploadID == "" {
+		delete(index.entries, key)
+	}
+}
+
+// forget removes the key regardless of its state, e.g. because the upload
+// recorded for it does not exist anymore.
+func (index *idempotencyIndex) forget(key string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	delete(index.entries, key)
+}
+
+// prune removes the entries which are older than the window. The caller must
+// hold the mutex.
+func (index *idempotencyIndex) prune(now time.Time) {
+	expired := 0
+	for _, entry := range index.order {
+		if now.Sub(entry.createdAt) < index.window {
+			break
+		}
+		expired++
+
+		// The key may have been released and reserved again in the meantime
+		if index.entries[entry.key] == entry {
+			delete(index.entries, entry.key)
+		}
+	}
+
+	index.order = index.order[expired:]
+}
+
+// idempotencyKey returns the key under which the creation request is recorded.
+// Keys are scoped by the owner recorded by the AuthorizeRequestCallback or, if
+// missing, by the client's IP address, so that clients cannot obtain uploads
+// created by others by guessing their keys.
+func (handler *UnroutedHandler) idempotencyKey(r *http.Request, owner string) string {
+	scope := "ip:" + handler.clientIP(r)
+	if owner != "" {
+		scope = "owner:" + owner
+	}
+
+	return scope + " " + r.Header.Get("Idempotency-Key")
+}
+
+// idempotencyFingerprint describes the properties of a creation request which
+// must match if it is repeated using the same Idempotency-Key.
+func idempotencyFingerprint(info FileInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %t %t %t %q", info.Size, info.SizeIsDeferred, info.IsPartial, info.IsFinal, info.PartialUploads)
+
+	keys := make([]string, 0, len(info.MetaData))
+	for key := range info.MetaData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %q=%q", key, info.MetaData[key])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,322 @@
+package handler_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	setup := func(t *testing.T, config Config) (*Handler, string) {
+		dir, err := ioutil.TempDir("", "tusd-idempotency-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		config.StoreComposer = composer
+		config.BasePath = "/files/"
+		handler, _ := NewHandler(config)
+
+		return handler, dir
+	}
+
+	countUploads := func(t *testing.T, dir string) int {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Every upload consists of a binary and an .info file
+		return len(files) / 2
+	}
+
+	SubTest(t, "Replay", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: time.Hour})
+		defer os.RemoveAll(dir)
+
+		first := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Upload-Metadata": "foo aGVsbG8=, bar d29ybGQ=",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Idempotent-Replayed": "",
+			},
+		}).Run(handler, t)
+
+		// The order of the metadata does not matter
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Upload-Metadata": "bar d29ybGQ=, foo aGVsbG8=",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location":            first.Header().Get("Location"),
+				"Upload-Offset":       "0",
+				"Idempotent-Replayed": "true",
+			},
+		}).Run(handler, t)
+
+		// Other keys create new uploads
+		second := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Upload-Metadata": "foo aGVsbG8=, bar d29ybGQ=",
+				"Idempotency-Key": "def",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.NotEqual(first.Header().Get("Location"), second.Header().Get("Location"))
+		a.Equal(2, countUploads(t, dir))
+	})
+
+	SubTest(t, "ReplayWithBody", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: time.Hour})
+		defer os.RemoveAll(dir)
+
+		first := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Content-Type":    "application/offset+octet-stream",
+				"Idempotency-Key": "abc",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+		url := first.Header().Get("Location")
+
+		// The chunk is not appended a second time
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Content-Type":    "application/offset+octet-stream",
+				"Idempotency-Key": "abc",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location":            url,
+				"Upload-Offset":       "5",
+				"Idempotent-Replayed": "true",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    strings.TrimPrefix(url, "http://tus.io/files/"),
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+
+		assert.Equal(t, 1, countUploads(t, dir))
+	})
+
+	SubTest(t, "Mismatch", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: time.Hour})
+		defer os.RemoveAll(dir)
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Upload-Metadata": "foo aGVsbG8=",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Upload-Metadata": "foo d29ybGQ=",
+				"Idempotency-Key": "abc",
+			},
+			Code:    http.StatusUnprocessableEntity,
+			ResBody: "Idempotency-Key has already been used for a different upload\n",
+		}).Run(handler, t)
+
+		assert.Equal(t, 1, countUploads(t, dir))
+	})
+
+	SubTest(t, "TerminatedUpload", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: time.Hour})
+		defer os.RemoveAll(dir)
+
+		req := httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+		}
+
+		first := req.Run(handler, t)
+		url := first.Header().Get("Location")
+
+		(&httpTest{
+			Method: "DELETE",
+			URL:    strings.TrimPrefix(url, "http://tus.io/files/"),
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		second := req.Run(handler, t)
+		a := assert.New(t)
+		a.NotEqual(url, second.Header().Get("Location"))
+		a.Equal("", second.Header().Get("Idempotent-Replayed"))
+		a.Equal(1, countUploads(t, dir))
+	})
+
+	SubTest(t, "OtherClient", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: time.Hour})
+		defer os.RemoveAll(dir)
+
+		req := httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+		}
+
+		first := req.Run(fromAddr(handler, "10.0.0.1"), t)
+		second := req.Run(fromAddr(handler, "10.0.0.2"), t)
+
+		a := assert.New(t)
+		a.NotEqual(first.Header().Get("Location"), second.Header().Get("Location"))
+		a.Equal("", second.Header().Get("Idempotent-Replayed"))
+		a.Equal(2, countUploads(t, dir))
+	})
+
+	SubTest(t, "OtherOwner", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{
+			IdempotencyKeyWindow:      time.Hour,
+			CreationRateLimitOwnerKey: "owner",
+			AuthorizeRequestCallback: func(hook HookEvent) (FileInfoChanges, error) {
+				owner := hook.HTTPRequest.Header.Get("X-Owner")
+				if owner == "" {
+					return FileInfoChanges{}, NewHTTPError(errors.New("unauthorized"), http.StatusUnauthorized)
+				}
+				return FileInfoChanges{MetaData: MetaData{"owner": owner}}, nil
+			},
+		})
+		defer os.RemoveAll(dir)
+
+		create := func(owner string, code int) *httptest.ResponseRecorder {
+			return (&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   "10",
+					"Idempotency-Key": "abc",
+					"X-Owner":         owner,
+				},
+				Code: code,
+			}).Run(handler, t)
+		}
+
+		// Requests are authorized before they are replayed and only replay uploads
+		// of the same owner, even from the same address
+		first := create("alice", http.StatusCreated)
+		create("", http.StatusUnauthorized)
+		second := create("bob", http.StatusCreated)
+		replayed := create("alice", http.StatusCreated)
+
+		a := assert.New(t)
+		a.NotEqual(first.Header().Get("Location"), second.Header().Get("Location"))
+		a.Equal("", second.Header().Get("Idempotent-Replayed"))
+		a.Equal(first.Header().Get("Location"), replayed.Header().Get("Location"))
+		a.Equal("true", replayed.Header().Get("Idempotent-Replayed"))
+		a.Equal(2, countUploads(t, dir))
+	})
+
+	SubTest(t, "WindowPassed", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: 10 * time.Millisecond})
+		defer os.RemoveAll(dir)
+
+		req := httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+		}
+
+		now := time.Date(2030, time.March, 4, 5, 6, 7, 0, time.UTC)
+		handler.SetNow(func() time.Time { return now })
+
+		first := req.Run(handler, t)
+		now = now.Add(10 * time.Millisecond)
+		second := req.Run(handler, t)
+
+		assert.NotEqual(t, first.Header().Get("Location"), second.Header().Get("Location"))
+		assert.Equal(t, 2, countUploads(t, dir))
+	})
+
+	SubTest(t, "Disabled", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{IdempotencyKeyWindow: 0})
+		defer os.RemoveAll(dir)
+
+		req := httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "10",
+				"Idempotency-Key": "abc",
+			},
+			Code: http.StatusCreated,
+		}
+
+		req.Run(handler, t)
+		req.Run(handler, t)
+
+		assert.Equal(t, 2, countUploads(t, dir))
+	})
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"errors"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Metrics provides numbers about the usage of the tusd handler. Since these may
@@ -20,6 +22,34 @@ type Metrics struct {
 	UploadsFinished   *uint64
 	UploadsCreated    *uint64
 	UploadsTerminated *uint64
+	// RequestsHandled counts the number of handled requests and the time spent
+	// on them per method, response status code, outcome and data store, see
+	// HandledRequest
+	RequestsHandled *RequestsHandledMap
+	// ChunkWritesInProgress is the number of requests whose body is currently
+	// being passed to the data store
+	ChunkWritesInProgress *int64
+	// RequestsQueued is the number of requests currently waiting in the upload
+	// queue, see Config.UploadQueueTimeout
+	RequestsQueued *int64
+	// QueueWaits counts the requests which have waited in the upload queue and
+	// QueueWaitDuration the total time spent waiting in nanoseconds
+	QueueWaits        *uint64
+	QueueWaitDuration *int64
+	// PatchChunkSizes counts the PATCH requests by the number of bytes written
+	// to the data store and PatchDurations by the time spent on them in
+	// seconds, see Config.ChunkSizeBuckets and Config.PatchDurationBuckets.
+	// Both are grouped by the request's outcome: completed if the upload has
+	// been finished, accepted if the chunk has been stored otherwise, rejected
+	// for responses with a 4xx status code and failed for all others.
+	PatchChunkSizes *HistogramMap
+	PatchDurations  *HistogramMap
+	// ChunksCutOff counts the PATCH requests whose body has been cut off at the
+	// MaxChunkSize
+	ChunksCutOff *uint64
+	// CompletionsDropped counts the events which have not been sent on the
+	// CompleteUploads channel because its buffer was full
+	CompletionsDropped *uint64
 }
 
 // incRequestsTotal increases the counter for this request method atomically by
@@ -57,7 +87,70 @@ func (m Metrics) incUploadsTerminated() {
 	atomic.AddUint64(m.UploadsTerminated, 1)
 }
 
-func newMetrics() Metrics {
+// incCompletionsDropped increases the counter for dropped completion
+// events atomically by one.
+func (m Metrics) incCompletionsDropped() {
+	atomic.AddUint64(m.CompletionsDropped, 1)
+}
+
+// incRequestsHandled records a handled request with its duration. The method
+// must be one of GET, HEAD, POST, PATCH, DELETE, OPTIONS.
+func (m Metrics) incRequestsHandled(req HandledRequest, duration time.Duration) {
+	if _, ok := m.RequestsTotal[req.Method]; !ok {
+		return
+	}
+
+	counter := m.RequestsHandled.retrieveCounterFor(req)
+	atomic.AddUint64(&counter.count, 1)
+	atomic.AddInt64(&counter.duration, int64(duration))
+}
+
+// incChunkWritesInProgress increases the number of in-progress chunk writes
+// atomically by one.
+func (m Metrics) incChunkWritesInProgress() {
+	atomic.AddInt64(m.ChunkWritesInProgress, 1)
+}
+
+// decChunkWritesInProgress decreases the number of in-progress chunk writes
+// atomically by one.
+func (m Metrics) decChunkWritesInProgress() {
+	atomic.AddInt64(m.ChunkWritesInProgress, -1)
+}
+
+// incRequestsQueued increases the number of queued requests atomically by one.
+func (m Metrics) incRequestsQueued() {
+	atomic.AddInt64(m.RequestsQueued, 1)
+}
+
+// decRequestsQueued decreases the number of queued requests atomically by one
+// and records the time the request has waited.
+func (m Metrics) decRequestsQueued(wait time.Duration) {
+	atomic.AddInt64(m.RequestsQueued, -1)
+	atomic.AddUint64(m.QueueWaits, 1)
+	atomic.AddInt64(m.QueueWaitDuration, int64(wait))
+}
+
+// observePatch records the chunk size and duration of a handled PATCH request
+// with the response status code.
+func (m Metrics) observePatch(statusCode int, stats chunkStats, duration time.Duration) {
+	outcome := "accepted"
+	switch {
+	case statusCode >= 500:
+		outcome = "failed"
+	case statusCode >= 400:
+		outcome = "rejected"
+	case stats.completed:
+		outcome = "completed"
+	}
+
+	m.PatchChunkSizes.observe(outcome, float64(stats.bytesWritten))
+	m.PatchDurations.observe(outcome, duration.Seconds())
+	if stats.cutOff {
+		atomic.AddUint64(m.ChunksCutOff, 1)
+	}
+}
+
+func newMetrics(chunkSizeBuckets []float64, patchDurationBuckets []float64) Metrics {
 	return Metrics{
 		RequestsTotal: map[string]*uint64{
 			"GET":     new(uint64),
@@ -67,11 +160,20 @@ func newMetrics() Metrics {
 			"DELETE":  new(uint64),
 			"OPTIONS": new(uint64),
 		},
-		ErrorsTotal:       newErrorsTotalMap(),
-		BytesReceived:     new(uint64),
-		UploadsFinished:   new(uint64),
-		UploadsCreated:    new(uint64),
-		UploadsTerminated: new(uint64),
+		ErrorsTotal:           newErrorsTotalMap(),
+		BytesReceived:         new(uint64),
+		UploadsFinished:       new(uint64),
+		UploadsCreated:        new(uint64),
+		UploadsTerminated:     new(uint64),
+		RequestsHandled:       newRequestsHandledMap(),
+		ChunkWritesInProgress: new(int64),
+		RequestsQueued:        new(int64),
+		QueueWaits:            new(uint64),
+		QueueWaitDuration:     new(int64),
+		PatchChunkSizes:       newHistogramMap(chunkSizeBuckets),
+		PatchDurations:        newHistogramMap(patchDurationBuckets),
+		ChunksCutOff:          new(uint64),
+		CompletionsDropped:    new(uint64),
 	}
 }
 
@@ -135,3 +237,164 @@ func (e *ErrorsTotalMap) Load() map[HTTPError]*uint64 {
 
 	return m
 }
+
+// HandledRequest identifies a group of handled requests by their method, the
+// status code of the response, their outcome and the data store.
+type HandledRequest struct {
+	Method     string
+	StatusCode int
+	// Outcome is "success" for responses which are not errors. For errors, it
+	// is the code also sent in JSON error responses, e.g. ERR_OFFSET_MISMATCH
+	// or ERR_UPLOAD_NOT_FOUND, or "error" for responses not sent by tusd.
+	Outcome string
+	// Store is the data store's name, see Config.StoreName.
+	Store string
+}
+
+// HandledRequestStats contains the number of handled requests and the total
+// time spent on handling them.
+type HandledRequestStats struct {
+	Count    uint64
+	Duration time.Duration
+}
+
+type handledRequestCounter struct {
+	count    uint64
+	duration int64
+}
+
+// RequestsHandledMap stores the counters for the handled requests.
+type RequestsHandledMap struct {
+	lock    sync.RWMutex
+	counter map[HandledRequest]*handledRequestCounter
+}
+
+func newRequestsHandledMap() *RequestsHandledMap {
+	return &RequestsHandledMap{
+		counter: make(map[HandledRequest]*handledRequestCounter, 20),
+	}
+}
+
+// retrieveCounterFor returns (after creating it if necessary) the counter for
+// the group of requests.
+func (e *RequestsHandledMap) retrieveCounterFor(req HandledRequest) *handledRequestCounter {
+	e.lock.RLock()
+	counter, ok := e.counter[req]
+	e.lock.RUnlock()
+	if ok {
+		return counter
+	}
+
+	// For counter creation, a write-lock is required
+	e.lock.Lock()
+	// We ensure that the counter wasn't created in the meantime
+	if counter, ok = e.counter[req]; !ok {
+		counter = new(handledRequestCounter)
+		e.counter[req] = counter
+	}
+	e.lock.Unlock()
+
+	return counter
+}
+
+// Load retrieves a snapshot of the counters atomically
+func (e *RequestsHandledMap) Load() map[HandledRequest]HandledRequestStats {
+	e.lock.RLock()
+	m := make(map[HandledRequest]HandledRequestStats, len(e.counter))
+	for req, counter := range e.counter {
+		m[req] = HandledRequestStats{
+			Count:    atomic.LoadUint64(&counter.count),
+			Duration: time.Duration(atomic.LoadInt64(&counter.duration)),
+		}
+	}
+	e.lock.RUnlock()
+
+	return m
+}
+
+// HistogramStats contains the number and sum of the values observed by a
+// histogram. Buckets maps the upper bound of each bucket to the number of
+// values less than or equal to it.
+type HistogramStats struct {
+	Count   uint64
+	Sum     float64
+	Buckets map[float64]uint64
+}
+
+type histogram struct {
+	lock  sync.Mutex
+	count uint64
+	sum   float64
+	// counts contains the number of values per bucket, which is not cumulative
+	// in contrast to HistogramStats.Buckets.
+	counts []uint64
+}
+
+// HistogramMap stores histograms with the same buckets for different label
+// values.
+type HistogramMap struct {
+	lock       sync.RWMutex
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+func newHistogramMap(buckets []float64) *HistogramMap {
+	return &HistogramMap{
+		buckets:    buckets,
+		histograms: make(map[string]*histogram, 4),
+	}
+}
+
+// observe records the value in the histogram for the label, after creating it
+// if necessary.
+func (e *HistogramMap) observe(label string, value float64) {
+	e.lock.RLock()
+	h, ok := e.histograms[label]
+	e.lock.RUnlock()
+	if !ok {
+		// For histogram creation, a write-lock is required
+		e.lock.Lock()
+		// We ensure that the histogram wasn't created in the meantime
+		if h, ok = e.histograms[label]; !ok {
+			h = &histogram{counts: make([]uint64, len(e.buckets))}
+			e.histograms[label] = h
+		}
+		e.lock.Unlock()
+	}
+
+	// The buckets are sorted, so the value belongs to the first one whose upper
+	// bound is not smaller. Values exceeding all bounds are only counted.
+	i := sort.SearchFloat64s(e.buckets, value)
+
+	h.lock.Lock()
+	h.count++
+	h.sum += value
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.lock.Unlock()
+}
+
+// Load retrieves a snapshot of the histograms per label
+func (e *HistogramMap) Load() map[string]HistogramStats {
+	e.lock.RLock()
+	m := make(map[string]HistogramStats, len(e.histograms))
+	for label, h := range e.histograms {
+		h.lock.Lock()
+		stats := HistogramStats{
+			Count:   h.count,
+			Sum:     h.sum,
+			Buckets: make(map[float64]uint64, len(e.buckets)),
+		}
+		var cumulative uint64
+		for i, bound := range e.buckets {
+			cumulative += h.counts[i]
+			stats.Buckets[bound] = cumulative
+		}
+		h.lock.Unlock()
+		m[label] = stats
+	}
+	e.lock.RUnlock()
+
+	return m
+}
@@ -0,0 +1,98 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+func TestMetrics(t *testing.T) {
+	SubTest(t, "RequestsHandled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(context.Background(), "no").Return(nil, ErrNotFound)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			StoreName:     "mockstore",
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "no",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusNotFound,
+		}).Run(handler, t)
+
+		// Responses without an explicit status are sent with 200 OK
+		(&httpTest{
+			Method: "GET",
+			Code:   http.StatusOK,
+		}).Run(handler.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), t)
+
+		a := assert.New(t)
+		stats := handler.Metrics.RequestsHandled.Load()
+		a.Len(stats, 3)
+		a.Equal(uint64(1), stats[HandledRequest{Method: "OPTIONS", StatusCode: http.StatusOK, Outcome: "success", Store: "mockstore"}].Count)
+		a.Equal(uint64(1), stats[HandledRequest{Method: "HEAD", StatusCode: http.StatusNotFound, Outcome: "ERR_UPLOAD_NOT_FOUND", Store: "mockstore"}].Count)
+		a.Equal(uint64(1), stats[HandledRequest{Method: "GET", StatusCode: http.StatusOK, Outcome: "success", Store: "mockstore"}].Count)
+	})
+
+	SubTest(t, "PartialWrite", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   10,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).DoAndReturn(
+				func(ctx context.Context, offset int64, src interface{}) (int64, error) {
+					assert.Equal(t, int64(1), atomic.LoadInt64(handler.Metrics.ChunkWritesInProgress))
+					return 3, errors.New("connection lost")
+				}),
+		)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusInternalServerError,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal(uint64(3), atomic.LoadUint64(handler.Metrics.BytesReceived))
+		a.Equal(int64(0), atomic.LoadInt64(handler.Metrics.ChunkWritesInProgress))
+		a.Equal(uint64(1), handler.Metrics.RequestsHandled.Load()[HandledRequest{
+			Method:     "PATCH",
+			StatusCode: http.StatusInternalServerError,
+			Outcome:    "ERR_INTERNAL_SERVER_ERROR",
+			Store:      "handler_test",
+		}].Count)
+	})
+}
@@ -29,6 +29,36 @@ func TestOptions(t *testing.T) {
 		}).Run(handler, t)
 	})
 
+	SubTest(t, "AllExtensions", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			ResHeader: map[string]string{
+				"Tus-Extension": "creation,creation-with-upload,termination,concatenation,creation-defer-length",
+				"Tus-Max-Size":  "",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UnregisteredExtension", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer = NewStoreComposer()
+		composer.UseCore(store)
+		composer.UseConcater(nil)
+		composer.UsesLengthDeferrer = true
+
+		_, err := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		if err == nil {
+			t.Error("expected error for length deferrer without implementation")
+		}
+	})
+
 	SubTest(t, "InvalidVersion", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		handler, _ := NewHandler(Config{
 			StoreComposer: composer,
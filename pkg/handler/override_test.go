@@ -0,0 +1,145 @@
+package handler_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+func TestMethodOverride(t *testing.T) {
+	SubTest(t, "Upload", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-override-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "10",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		(&httpTest{
+			Name:   "First chunk",
+			Method: "POST",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable":          "1.0.0",
+				"Content-Type":           "application/offset+octet-stream",
+				"Upload-Offset":          "0",
+				"X-HTTP-Method-Override": "PATCH",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Resumption",
+			Method: "POST",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"X-Method-Override": "HEAD",
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+				"Upload-Length": "10",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Second chunk",
+			Method: "POST",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable":     "1.0.0",
+				"Content-Type":      "application/offset+octet-stream",
+				"Upload-Offset":     "5",
+				"X-Method-Override": "patch",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "10",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Download",
+			Method: "POST",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"X-HTTP-Method-Override": "GET",
+			},
+			Code:    http.StatusOK,
+			ResBody: "helloworld",
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Termination",
+			Method: "POST",
+			URL:    id,
+			ReqHeader: map[string]string{
+				"Tus-Resumable":          "1.0.0",
+				"X-HTTP-Method-Override": "DELETE",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "OnlyPost", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		// A GET request must not be turned into a DELETE request
+		(&httpTest{
+			Method: "GET",
+			URL:    "",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":          "1.0.0",
+				"X-HTTP-Method-Override": "DELETE",
+			},
+			Code: http.StatusMethodNotAllowed,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UnsupportedMethod", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		// The override is ignored, so the request is handled as creation
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":          "1.0.0",
+				"X-HTTP-Method-Override": "PUT",
+			},
+			Code:    http.StatusBadRequest,
+			ResBody: "missing or invalid Upload-Length header\n",
+		}).Run(handler, t)
+	})
+}
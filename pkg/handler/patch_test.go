@@ -1,19 +1,29 @@
 package handler_test
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/tus/tusd/pkg/filestore"
 	. "github.com/tus/tusd/pkg/handler"
+	"github.com/tus/tusd/pkg/memorylocker"
 )
 
 func TestPatch(t *testing.T) {
@@ -31,6 +41,15 @@ func TestPatch(t *testing.T) {
 			}, nil),
 			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
 			upload.EXPECT().FinishUpload(context.Background()),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   10,
+				Storage: map[string]string{
+					"Type": "mockstore",
+					"Key":  "final/yes",
+				},
+			}, nil),
 		)
 
 		handler, _ := NewHandler(Config{
@@ -62,6 +81,7 @@ func TestPatch(t *testing.T) {
 		a.Equal("yes", info.ID)
 		a.EqualValues(int64(10), info.Size)
 		a.Equal(int64(10), info.Offset)
+		a.Equal("final/yes", info.Storage["Key"])
 
 		req := event.HTTPRequest
 		a.Equal("PATCH", req.Method)
@@ -185,6 +205,45 @@ func TestPatch(t *testing.T) {
 				"Upload-Offset": "4",
 			},
 			Code: http.StatusConflict,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+				"Cache-Control": "no-store",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "MissmatchingOffsetJSONFail", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			JSONErrors:    true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "4",
+			},
+			Code:    http.StatusConflict,
+			ResBody: `{"code":"ERR_OFFSET_MISMATCH","message":"mismatched offset"}` + "\n",
+			ResHeader: map[string]string{
+				"Content-Type":  "application/json; charset=utf-8",
+				"Upload-Offset": "5",
+			},
 		}).Run(handler, t)
 	})
 
@@ -451,6 +510,345 @@ func TestPatch(t *testing.T) {
 		}).Run(handler, t)
 	})
 
+	SubTest(t, "DeferredLengthExceedingMaxSize", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// The body is cut off once the upload reaches the maximum size, although
+		// the request announces a larger Content-Length.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:             "yes",
+				Offset:         15,
+				SizeIsDeferred: true,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(15), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			MaxSize:       20,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "15",
+			},
+			ReqBody: strings.NewReader("hello world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "20",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DeferredLengthMaxSizeReachedFail", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:             "yes",
+				Offset:         20,
+				SizeIsDeferred: true,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			MaxSize:       20,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "20",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusRequestEntityTooLarge,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "FinishedUploadFail", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// A client which ignored the offset of a deduplicated upload must not be
+		// able to overwrite its content.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 20,
+				Size:   20,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusConflict,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "IncompleteBody", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hel")).Return(int64(3), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		// The body ends after three bytes although five have been announced
+		req, _ := http.NewRequest("PATCH", "yes", strings.NewReader("hel"))
+		req.ContentLength = 5
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "5")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		a := assert.New(t)
+		a.Equal(http.StatusBadRequest, res.Code)
+		a.Equal("8", res.Header().Get("Upload-Offset"))
+		a.Equal("request body is shorter than Content-Length\n", res.Body.String())
+	})
+
+	SubTest(t, "IncompleteBodyServer", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		a := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "tusd-patch-test")
+		a.NoError(err)
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+		})
+
+		server := httptest.NewServer(http.StripPrefix("/files/", handler))
+		defer server.Close()
+
+		req, _ := http.NewRequest("POST", server.URL+"/files/", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", "10")
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal(http.StatusCreated, res.StatusCode)
+		location, _ := url.Parse(res.Header.Get("Location"))
+
+		// The client announces ten bytes but stops sending after three
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		a.NoError(err)
+		defer conn.Close()
+		fmt.Fprintf(conn, "PATCH %s HTTP/1.1\r\nHost: %s\r\nTus-Resumable: 1.0.0\r\n"+
+			"Content-Type: application/offset+octet-stream\r\nUpload-Offset: 0\r\n"+
+			"Content-Length: 10\r\n\r\nhel", location.Path, location.Host)
+		a.NoError(conn.(*net.TCPConn).CloseWrite())
+
+		res, err = http.ReadResponse(bufio.NewReader(conn), nil)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal(http.StatusBadRequest, res.StatusCode)
+		a.Equal("3", res.Header.Get("Upload-Offset"))
+
+		req, _ = http.NewRequest("HEAD", location.String(), nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		res, err = http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal("3", res.Header.Get("Upload-Offset"))
+	})
+
+	SubTest(t, "CompleteOnce", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		a := assert.New(t)
+
+		dir, err := ioutil.TempDir("", "tusd-patch-test")
+		a.NoError(err)
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			BasePath:              "/files/",
+			NotifyCompleteUploads: true,
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		// Retrying the final chunk does not finish the upload again
+		patch := func(offset string, body string) {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    id,
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": offset,
+				},
+				ReqBody: strings.NewReader(body),
+				Code:    http.StatusNoContent,
+				ResHeader: map[string]string{
+					"Upload-Offset": "5",
+				},
+			}).Run(handler, t)
+		}
+		patch("0", "hello")
+		patch("5", "")
+
+		event := <-handler.CompleteUploads
+		a.Equal(id, event.Upload.ID)
+		a.Equal(int64(5), event.Upload.Offset)
+		a.Len(handler.CompleteUploads, 0)
+	})
+
+	SubTest(t, "RetryFinish", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		complete := FileInfo{
+			ID:     "yes",
+			Offset: 10,
+			Size:   10,
+		}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(context.Background()).Return(errors.New("store unavailable")),
+			// The retry finishes the upload ...
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(complete, nil),
+			upload.EXPECT().FinishUpload(context.Background()).Return(nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(complete, nil),
+			// ... but further requests do not
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(complete, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+		})
+
+		patch := func(offset string, body string, code int) {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": offset,
+				},
+				ReqBody: strings.NewReader(body),
+				Code:    code,
+			}).Run(handler, t)
+		}
+		patch("5", "hello", http.StatusInternalServerError)
+		a := assert.New(t)
+		a.Len(handler.CompleteUploads, 0)
+
+		patch("10", "", http.StatusNoContent)
+		patch("10", "", http.StatusNoContent)
+		a.Len(handler.CompleteUploads, 1)
+		event := <-handler.CompleteUploads
+		a.Equal("yes", event.Upload.ID)
+	})
+
+	SubTest(t, "DropCompletion", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(context.Background()).Return(nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   10,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+		})
+		// Nobody consumes the events, which must not block the response
+		handler.CompleteUploads = make(chan HookEvent)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		assert.Equal(t, uint64(1), atomic.LoadUint64(handler.Metrics.CompletionsDropped))
+	})
+
 	SubTest(t, "Locker", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -492,6 +890,272 @@ func TestPatch(t *testing.T) {
 		}).Run(handler, t)
 	})
 
+	SubTest(t, "ConcurrentLocked", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		writing := make(chan struct{})
+		release := make(chan struct{})
+
+		// Only the first request reaches the data store since the second one is
+		// rejected while the first one is still holding the lock.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).DoAndReturn(
+				func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+					close(writing)
+					<-release
+					return 5, nil
+				}),
+		)
+
+		composer = NewStoreComposer()
+		composer.UseCore(store)
+		memorylocker.New().UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			LockedRetryAfter: 1500 * time.Millisecond,
+		})
+
+		done := make(chan struct{})
+		go func() {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": "0",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusNoContent,
+			}).Run(handler, t)
+			close(done)
+		}()
+
+		<-writing
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusLocked,
+			ResHeader: map[string]string{
+				"Retry-After": "2",
+			},
+		}).Run(handler, t)
+
+		close(release)
+		<-done
+	})
+
+	SubTest(t, "MaxChunkSize", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		tests := []struct {
+			name    string
+			body    string
+			written string
+		}{
+			{"BelowLimit", "hel", "hel"},
+			{"AtLimit", "hello", "hello"},
+			{"AboveLimit", "hello world", "hello"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+				upload := NewMockFullUpload(ctrl)
+
+				gomock.InOrder(
+					store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+					upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+						ID:     "yes",
+						Offset: 5,
+						Size:   100,
+					}, nil),
+					upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher(test.written)).Return(int64(len(test.written)), nil),
+				)
+
+				handler, _ := NewHandler(Config{
+					StoreComposer: composer,
+					MaxChunkSize:  5,
+				})
+
+				(&httpTest{
+					Method: "PATCH",
+					URL:    "yes",
+					ReqHeader: map[string]string{
+						"Tus-Resumable": "1.0.0",
+						"Content-Type":  "application/offset+octet-stream",
+						"Upload-Offset": "5",
+					},
+					ReqBody: strings.NewReader(test.body),
+					Code:    http.StatusNoContent,
+					ResHeader: map[string]string{
+						"Upload-Offset": strconv.Itoa(5 + len(test.written)),
+					},
+				}).Run(handler, t)
+			})
+		}
+	})
+
+	SubTest(t, "UploadQueue", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		writing := make(chan struct{})
+		release := make(chan struct{})
+
+		// The second request waits until the first one has finished and then
+		// continues from the new offset.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).DoAndReturn(
+				func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+					close(writing)
+					<-release
+					return 5, nil
+				}),
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher("world")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			UploadQueueTimeout: 10 * time.Second,
+		})
+
+		done := make(chan struct{})
+		go func() {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": "0",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusNoContent,
+			}).Run(handler, t)
+			close(done)
+		}()
+
+		<-writing
+		go func() {
+			for atomic.LoadInt64(handler.Metrics.RequestsQueued) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+		}()
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "10",
+			},
+		}).Run(handler, t)
+
+		<-done
+		a := assert.New(t)
+		a.Equal(int64(0), atomic.LoadInt64(handler.Metrics.RequestsQueued))
+		a.Equal(uint64(2), atomic.LoadUint64(handler.Metrics.QueueWaits))
+	})
+
+	SubTest(t, "UploadQueueTimeout", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		writing := make(chan struct{})
+		release := make(chan struct{})
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).DoAndReturn(
+				func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+					close(writing)
+					<-release
+					return 5, nil
+				}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			UploadQueueTimeout: 50 * time.Millisecond,
+		})
+
+		done := make(chan struct{})
+		go func() {
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": "0",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusNoContent,
+			}).Run(handler, t)
+			close(done)
+		}()
+
+		<-writing
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusServiceUnavailable,
+			ResHeader: map[string]string{
+				"Retry-After": "1",
+			},
+		}).Run(handler, t)
+
+		close(release)
+		<-done
+	})
+
 	SubTest(t, "NotifyUploadProgress", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -3,7 +3,9 @@ package handler_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -70,6 +72,49 @@ func TestPost(t *testing.T) {
 		a.Equal(int64(300), info.Size)
 	})
 
+	SubTest(t, "CreateExposedStorageFields", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(context.Background(), FileInfo{
+				Size:     300,
+				MetaData: map[string]string{},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:   "foo",
+				Size: 300,
+				Storage: map[string]string{
+					"Type":   "s3store",
+					"Bucket": "my-bucket",
+					"Key":    "foo",
+				},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			BasePath:             "/files/",
+			ExposedStorageFields: []string{"Key", "Unknown"},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location":                 "http://tus.io/files/foo",
+				"X-Upload-Storage-Key":     "foo",
+				"X-Upload-Storage-Bucket":  "",
+				"X-Upload-Storage-Unknown": "",
+			},
+		}).Run(handler, t)
+	})
+
 	SubTest(t, "CreateEmptyUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -86,6 +131,11 @@ func TestPost(t *testing.T) {
 				MetaData: map[string]string{},
 			}, nil),
 			upload.EXPECT().FinishUpload(context.Background()).Return(nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:       "foo",
+				Size:     0,
+				MetaData: map[string]string{},
+			}, nil),
 		)
 
 		handler, _ := NewHandler(Config{
@@ -121,6 +171,61 @@ func TestPost(t *testing.T) {
 		a.Equal("", req.URI)
 	})
 
+	SubTest(t, "CreateDeduplicated", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// The data store already holds the upload's entire content, so the
+		// upload is finished right away and the chunk is not written.
+		gomock.InOrder(
+			store.EXPECT().NewUpload(context.Background(), FileInfo{
+				Size:     300,
+				MetaData: map[string]string{},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "foo",
+				Offset: 300,
+				Size:   300,
+			}, nil),
+			upload.EXPECT().FinishUpload(context.Background()).Return(nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "foo",
+				Offset: 300,
+				Size:   300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			BasePath:              "/files/",
+			NotifyCompleteUploads: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"Content-Type":  "application/offset+octet-stream",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location":      "http://tus.io/files/foo",
+				"Upload-Offset": "300",
+			},
+		}).Run(handler, t)
+
+		event := <-c
+		a := assert.New(t)
+		a.Equal("foo", event.Upload.ID)
+		a.Equal(int64(300), event.Upload.Offset)
+	})
+
 	SubTest(t, "CreateExceedingMaxSizeFail", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		handler, _ := NewHandler(Config{
 			MaxSize:       400,
@@ -358,6 +463,336 @@ func TestPost(t *testing.T) {
 		})
 	})
 
+	SubTest(t, "PreUploadCreateCallback", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		SubTest(t, "Accept", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size: 300,
+					MetaData: map[string]string{
+						"foo": "hello",
+					},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:   "foo",
+					Size: 300,
+					MetaData: map[string]string{
+						"foo": "hello",
+					},
+				}, nil),
+			)
+
+			var event HookEvent
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+				PreUploadCreateCallback: func(hook HookEvent) (FileInfoChanges, error) {
+					event = hook
+					return FileInfoChanges{}, nil
+				},
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   "300",
+					"Upload-Metadata": "foo aGVsbG8=",
+				},
+				Code: http.StatusCreated,
+				ResHeader: map[string]string{
+					"Location": "http://tus.io/files/foo",
+				},
+			}).Run(handler, t)
+
+			a := assert.New(t)
+			a.Equal(int64(300), event.Upload.Size)
+			a.Equal("hello", event.Upload.MetaData["foo"])
+			a.Equal("POST", event.HTTPRequest.Method)
+			a.NotNil(event.Context)
+		})
+
+		SubTest(t, "Reject", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+				PreUploadCreateCallback: func(hook HookEvent) (FileInfoChanges, error) {
+					return FileInfoChanges{}, NewHTTPError(errors.New("filehash is required"), http.StatusUnprocessableEntity)
+				},
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Length": "300",
+				},
+				Code:    http.StatusUnprocessableEntity,
+				ResBody: "filehash is required\n",
+				ResHeader: map[string]string{
+					"Location": "",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "Mutate", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size: 300,
+					MetaData: map[string]string{
+						"foo":   "hello",
+						"owner": "alice",
+					},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:   "foo",
+					Size: 300,
+					MetaData: map[string]string{
+						"foo":   "hello",
+						"owner": "alice",
+					},
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+				PreUploadCreateCallback: func(hook HookEvent) (FileInfoChanges, error) {
+					meta := MetaData{}
+					for key, value := range hook.Upload.MetaData {
+						meta[key] = value
+					}
+					meta["owner"] = "alice"
+
+					return FileInfoChanges{MetaData: meta}, nil
+				},
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   "300",
+					"Upload-Metadata": "foo aGVsbG8=",
+				},
+				Code: http.StatusCreated,
+				ResHeader: map[string]string{
+					"Location": "http://tus.io/files/foo",
+				},
+			}).Run(handler, t)
+		})
+	})
+
+	SubTest(t, "Metadata", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		SubTest(t, "Rejected", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			handler, _ := NewHandler(Config{
+				StoreComposer:       composer,
+				StrictMetadata:      true,
+				AllowedMetadataKeys: []string{"filename", "filetype", "acl"},
+				DeniedMetadataKeys:  []string{"acl"},
+				MetadataValidators: map[string]func(string) error{
+					"filetype": func(value string) error {
+						if !strings.Contains(value, "/") {
+							return errors.New("not a MIME type")
+						}
+						return nil
+					},
+				},
+			})
+
+			tests := []struct {
+				name   string
+				header string
+				body   string
+			}{
+				{"InvalidBase64", "filename INVALID", "invalid Upload-Metadata header: value for key \"filename\" is not valid base64\n"},
+				{"DuplicateKey", "filename aGVsbG8=,filename d29ybGQ=", "invalid Upload-Metadata header: duplicate key \"filename\"\n"},
+				{"DeniedKey", "acl cHVibGlj", "metadata key \"acl\" is not allowed\n"},
+				{"UnknownKey", "storage-class R0xBQ0lFUg==", "metadata key \"storage-class\" is not allowed\n"},
+				{"InvalidValue", "filetype aW1hZ2U=", "invalid value for metadata key \"filetype\": not a MIME type\n"},
+			}
+
+			for _, test := range tests {
+				(&httpTest{
+					Name:   test.name,
+					Method: "POST",
+					ReqHeader: map[string]string{
+						"Tus-Resumable":   "1.0.0",
+						"Upload-Length":   "300",
+						"Upload-Metadata": test.header,
+					},
+					Code:    http.StatusBadRequest,
+					ResBody: test.body,
+				}).Run(handler, t)
+			}
+		})
+
+		SubTest(t, "ReservedKeys", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size: 300,
+					MetaData: map[string]string{
+						"filename": "hello",
+						"owner":    "alice",
+					},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:   "foo",
+					Size: 300,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:        composer,
+				StrictMetadata:       true,
+				ReservedMetadataKeys: []string{"owner"},
+				PreUploadCreateCallback: func(hook HookEvent) (FileInfoChanges, error) {
+					if _, ok := hook.Upload.MetaData["owner"]; ok {
+						t.Error("reserved key must be removed before the callback is invoked")
+					}
+
+					meta := MetaData{"owner": "alice"}
+					for key, value := range hook.Upload.MetaData {
+						meta[key] = value
+					}
+					return FileInfoChanges{MetaData: meta}, nil
+				},
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   "300",
+					"Upload-Metadata": "filename aGVsbG8=, owner Ym9i",
+				},
+				Code: http.StatusCreated,
+			}).Run(handler, t)
+		})
+	})
+
+	SubTest(t, "RecordRequestMetadata", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		tests := []struct {
+			name       string
+			remoteAddr string
+			forwarded  []string
+			clientIP   string
+		}{
+			{"Direct", "203.0.113.7:4321", nil, "203.0.113.7"},
+			{"UntrustedPeer", "203.0.113.7:4321", []string{"198.51.100.1"}, "203.0.113.7"},
+			{"TrustedProxy", "10.0.0.2:4321", []string{"198.51.100.1"}, "198.51.100.1"},
+			{"ProxyChain", "10.0.0.2:4321", []string{"198.51.100.1, 192.168.1.5"}, "198.51.100.1"},
+			{"ForgedEntry", "10.0.0.2:4321", []string{"1.2.3.4, 198.51.100.1", "192.168.1.5"}, "198.51.100.1"},
+			{"MalformedEntry", "10.0.0.2:4321", []string{"198.51.100.1, garbage"}, "10.0.0.2"},
+			{"OnlyProxies", "10.0.0.2:4321", []string{"192.168.1.5"}, "192.168.1.5"},
+			{"TrustedProxyWithoutHeader", "10.0.0.2:4321", nil, "10.0.0.2"},
+			{"IPv6", "[2001:db8::2]:4321", []string{"198.51.100.1"}, "198.51.100.1"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+				upload := NewMockFullUpload(ctrl)
+
+				gomock.InOrder(
+					store.EXPECT().NewUpload(context.Background(), FileInfo{
+						Size: 300,
+						MetaData: map[string]string{
+							"filename":  "hello",
+							"client_ip": test.clientIP,
+							"useragent": "tus-js-client",
+							"tenant":    "acme",
+						},
+					}).Return(upload, nil),
+					upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+						ID:   "foo",
+						Size: 300,
+					}, nil),
+				)
+
+				handler, _ := NewHandler(Config{
+					StoreComposer:        composer,
+					ClientIPMetadataKey:  "client_ip",
+					UserAgentMetadataKey: "useragent",
+					HeaderMetadataKeys: map[string]string{
+						"X-Tenant": "tenant",
+					},
+					TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"},
+				})
+
+				req, _ := http.NewRequest("POST", "", nil)
+				req.Header.Set("Tus-Resumable", "1.0.0")
+				req.Header.Set("Upload-Length", "300")
+				// Clients must not be able to spoof the recorded values
+				req.Header.Set("Upload-Metadata", "filename aGVsbG8=, client_ip MTI3LjAuMC4x")
+				req.Header.Set("User-Agent", "tus-js-client")
+				req.Header.Set("X-Tenant", "acme")
+				for _, value := range test.forwarded {
+					req.Header.Add("X-Forwarded-For", value)
+				}
+				req.RemoteAddr = test.remoteAddr
+				req.Host = "tus.io"
+
+				res := httptest.NewRecorder()
+				handler.ServeHTTP(res, req)
+				assert.Equal(t, http.StatusCreated, res.Code)
+			})
+		}
+
+		t.Run("MissingHeaders", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			// Values supplied by the client for the keys are removed as well
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size: 300,
+					MetaData: map[string]string{
+						"filename":  "hello",
+						"client_ip": "203.0.113.7",
+					},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:   "foo",
+					Size: 300,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:        composer,
+				ClientIPMetadataKey:  "client_ip",
+				UserAgentMetadataKey: "useragent",
+				HeaderMetadataKeys: map[string]string{
+					"X-Tenant": "tenant",
+				},
+			})
+
+			req, _ := http.NewRequest("POST", "", nil)
+			req.Header.Set("Tus-Resumable", "1.0.0")
+			req.Header.Set("Upload-Length", "300")
+			req.Header.Set("Upload-Metadata", "filename aGVsbG8=, tenant ZXZpbA==")
+			req.RemoteAddr = "203.0.113.7:4321"
+			req.Host = "tus.io"
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusCreated, res.Code)
+		})
+	})
+
 	SubTest(t, "WithUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		SubTest(t, "Create", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 			ctrl := gomock.NewController(t)
@@ -414,6 +849,176 @@ func TestPost(t *testing.T) {
 			}).Run(handler, t)
 		})
 
+		SubTest(t, "CreateComplete", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size:     5,
+					MetaData: map[string]string{},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:       "foo",
+					Size:     5,
+					MetaData: map[string]string{},
+				}, nil),
+				upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+				upload.EXPECT().FinishUpload(context.Background()).Return(nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Length": "5",
+					"Content-Type":  "application/offset+octet-stream",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusCreated,
+				ResHeader: map[string]string{
+					"Location":      "http://tus.io/files/foo",
+					"Upload-Offset": "5",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "CreateDeferredLengthExceedingMaxSize", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					SizeIsDeferred: true,
+					MetaData:       map[string]string{},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:             "foo",
+					SizeIsDeferred: true,
+					MetaData:       map[string]string{},
+				}, nil),
+				upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+				MaxSize:       5,
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":       "1.0.0",
+					"Upload-Defer-Length": "1",
+					"Content-Type":        "application/offset+octet-stream",
+				},
+				ReqBody: strings.NewReader("hello world"),
+				Code:    http.StatusCreated,
+				ResHeader: map[string]string{
+					"Location":      "http://tus.io/files/foo",
+					"Upload-Offset": "5",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "CreateWriteFailCleanup", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size:     5,
+					MetaData: map[string]string{},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:       "foo",
+					Size:     5,
+					MetaData: map[string]string{},
+				}, nil),
+				upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).Return(int64(0), errors.New("permission denied")),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:       "foo",
+					Size:     5,
+					Offset:   0,
+					MetaData: map[string]string{},
+				}, nil),
+				store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+				upload.EXPECT().Terminate(context.Background()).Return(nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Length": "5",
+					"Content-Type":  "application/offset+octet-stream",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusInternalServerError,
+				ResHeader: map[string]string{
+					"Location": "",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "CreatePartialWriteKeepsUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().NewUpload(context.Background(), FileInfo{
+					Size:     5,
+					MetaData: map[string]string{},
+				}).Return(upload, nil),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:       "foo",
+					Size:     5,
+					MetaData: map[string]string{},
+				}, nil),
+				upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).Return(int64(3), errors.New("connection lost")),
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:       "foo",
+					Size:     5,
+					Offset:   3,
+					MetaData: map[string]string{},
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer: composer,
+				BasePath:      "/files/",
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Length": "5",
+					"Content-Type":  "application/offset+octet-stream",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusInternalServerError,
+				ResHeader: map[string]string{
+					"Location": "http://tus.io/files/foo",
+				},
+			}).Run(handler, t)
+		})
+
 		SubTest(t, "CreateExceedingUploadSize", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -429,6 +1034,14 @@ func TestPost(t *testing.T) {
 					Size:     300,
 					MetaData: map[string]string{},
 				}, nil),
+				// The upload is removed again since no data has been stored
+				upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+					ID:       "foo",
+					Size:     300,
+					MetaData: map[string]string{},
+				}, nil),
+				store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+				upload.EXPECT().Terminate(context.Background()).Return(nil),
 			)
 
 			handler, _ := NewHandler(Config{
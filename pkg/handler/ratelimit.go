@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter keeps the token buckets used for limiting how many uploads a
+// client may create, see Config.CreationRateLimit. The default implementation
+// keeps the buckets in memory, see MemoryRateLimiter. Deployments running
+// multiple instances can share the buckets by implementing this interface on
+// top of a shared storage, e.g. Redis.
+type RateLimiter interface {
+	// Take removes a token from the bucket identified by the key. The bucket
+	// holds at most burst tokens and is refilled by rate tokens per second. A
+	// bucket which has not been used before is full. If the bucket is empty, no
+	// token is removed and the duration after which the next token is available
+	// is returned. Otherwise, the returned duration is 0. Implementations
+	// shared by multiple instances must check and remove the token atomically.
+	Take(ctx context.Context, key string, rate float64, burst int) (time.Duration, error)
+}
+
+// MemoryRateLimiter is a RateLimiter keeping the buckets in memory, so that
+// they are not shared with other processes.
+type MemoryRateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	// lastPrune is the time at which full buckets have been removed last.
+	lastPrune time.Time
+	// now returns the current time and is replaced in tests.
+	now func() time.Time
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewMemoryRateLimiter creates a new MemoryRateLimiter without any buckets.
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+func (limiter *MemoryRateLimiter) Take(ctx context.Context, key string, rate float64, burst int) (time.Duration, error) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	limiter.prune(now, rate, burst)
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens:    float64(burst),
+			updatedAt: now,
+		}
+		limiter.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / rate * float64(time.Second)), nil
+	}
+
+	bucket.tokens--
+	return 0, nil
+}
+
+// prune removes the buckets which have been refilled completely, since they
+// do not differ from buckets which have not been used yet. To avoid iterating
+// over all buckets for every request, this only happens once in the duration
+// needed for refilling a bucket.
+func (limiter *MemoryRateLimiter) prune(now time.Time, rate float64, burst int) {
+	refill := time.Duration(float64(burst) / rate * float64(time.Second))
+	if now.Sub(limiter.lastPrune) < refill {
+		return
+	}
+
+	for key, bucket := range limiter.buckets {
+		if now.Sub(bucket.updatedAt) >= refill {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastPrune = now
+}
+
+// rateLimitedError rejects a request because the client exceeded its rate
+// limit. The Retry-After header tells the client when it may try again.
+type rateLimitedError struct {
+	HTTPError
+	retryAfter time.Duration
+}
+
+func (err rateLimitedError) ErrorCode() string {
+	return errorCodes[ErrRateLimited]
+}
+
+// limitCreation takes a token from the creating client's bucket, if creation
+// requests are rate limited. The client is identified by the owner recorded by
+// the AuthorizeRequestCallback or, if missing, by its IP address. If the rate
+// limiter fails, the request is not limited, so that uploads can still be
+// created.
+func (handler *UnroutedHandler) limitCreation(r *http.Request, owner string) error {
+	config := handler.config
+	if config.CreationRateLimit <= 0 {
+		return nil
+	}
+
+	ip := handler.clientIP(r)
+	if handler.isRateLimitExempt(ip, owner) {
+		return nil
+	}
+
+	key := "ip:" + ip
+	if owner != "" {
+		key = "owner:" + owner
+	}
+
+	retryAfter, err := config.CreationRateLimiter.Take(newStoreContext(r), key, config.CreationRateLimit, config.CreationRateBurst)
+	if err != nil {
+		handler.log("RateLimiterError", "error", err.Error(), "requestId", getRequestId(r))
+		return nil
+	}
+	if retryAfter > 0 {
+		handler.log("CreationRateLimited", "client", key, "requestId", getRequestId(r))
+		return rateLimitedError{ErrRateLimited, retryAfter}
+	}
+
+	return nil
+}
+
+// isRateLimitExempt checks whether the client's address or owner is listed in
+// CreationRateLimitExempt.
+func (handler *UnroutedHandler) isRateLimitExempt(ip string, owner string) bool {
+	if owner != "" && containsString(handler.config.CreationRateLimitExempt, owner) {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, network := range handler.config.creationRateLimitExempt {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,198 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Take(ctx context.Context, key string, rate float64, burst int) (time.Duration, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestCreationRateLimit(t *testing.T) {
+	setup := func(t *testing.T, config Config) (http.Handler, string) {
+		dir, err := ioutil.TempDir("", "tusd-ratelimit-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		config.StoreComposer = composer
+		config.BasePath = "/files/"
+		handler, err := NewHandler(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return handler, dir
+	}
+
+	create := func(code int, headers ...string) *httpTest {
+		test := &httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "10",
+			},
+			Code: code,
+		}
+		for i := 0; i < len(headers); i += 2 {
+			test.ReqHeader[headers[i]] = headers[i+1]
+		}
+		return test
+	}
+
+	SubTest(t, "Enforce", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{
+			CreationRateLimit: 0.001,
+			CreationRateBurst: 2,
+			JSONErrors:        true,
+		})
+		defer os.RemoveAll(dir)
+
+		create(http.StatusCreated).Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusCreated).Run(fromAddr(handler, "10.0.0.1"), t)
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "10",
+			},
+			Code: http.StatusTooManyRequests,
+			ResHeader: map[string]string{
+				"Retry-After": "1000",
+			},
+		}).Run(fromAddr(handler, "10.0.0.1"), t)
+		assert.Contains(t, res.Body.String(), `"code":"ERR_RATE_LIMITED"`)
+
+		// Other clients have their own buckets
+		create(http.StatusCreated).Run(fromAddr(handler, "10.0.0.2"), t)
+	})
+
+	SubTest(t, "Refill", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		limiter := NewMemoryRateLimiter()
+		now := time.Date(2030, time.March, 4, 5, 6, 7, 0, time.UTC)
+		limiter.SetNow(func() time.Time { return now })
+		ctx := context.Background()
+
+		// A token is added every 50ms
+		wait, err := limiter.Take(ctx, "a", 20, 1)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+
+		wait, err = limiter.Take(ctx, "a", 20, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 50*time.Millisecond, wait)
+
+		now = now.Add(20 * time.Millisecond)
+		wait, _ = limiter.Take(ctx, "a", 20, 1)
+		assert.Equal(t, 30*time.Millisecond, wait)
+
+		now = now.Add(30 * time.Millisecond)
+		wait, err = limiter.Take(ctx, "a", 20, 1)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+
+		// The bucket does not exceed the burst while unused
+		now = now.Add(time.Second)
+		wait, _ = limiter.Take(ctx, "a", 20, 1)
+		assert.Zero(t, wait)
+		wait, _ = limiter.Take(ctx, "a", 20, 1)
+		assert.Equal(t, 50*time.Millisecond, wait)
+	})
+
+	SubTest(t, "Owner", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{
+			CreationRateLimit:         0.001,
+			CreationRateLimitOwnerKey: "owner",
+			CreationRateLimitExempt:   []string{"10.1.0.0/16", "importer"},
+			AuthorizeRequestCallback: func(hook HookEvent) (FileInfoChanges, error) {
+				owner := hook.HTTPRequest.Header.Get("X-Owner")
+				if owner == "" {
+					return FileInfoChanges{}, nil
+				}
+				return FileInfoChanges{MetaData: MetaData{"owner": owner}}, nil
+			},
+		})
+		defer os.RemoveAll(dir)
+
+		// Owners are limited independently of their address
+		create(http.StatusCreated, "X-Owner", "alice").Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusTooManyRequests, "X-Owner", "alice").Run(fromAddr(handler, "10.0.0.2"), t)
+		create(http.StatusCreated, "X-Owner", "bob").Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusCreated).Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusTooManyRequests).Run(fromAddr(handler, "10.0.0.1"), t)
+
+		// Exempt owners and networks are not limited
+		for i := 0; i < 3; i++ {
+			create(http.StatusCreated, "X-Owner", "importer").Run(fromAddr(handler, "10.0.0.1"), t)
+			create(http.StatusCreated, "X-Owner", "alice").Run(fromAddr(handler, "10.1.2.3"), t)
+			create(http.StatusCreated).Run(fromAddr(handler, "10.1.2.3"), t)
+		}
+	})
+
+	SubTest(t, "ForgedOwner", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{
+			CreationRateLimit:         0.001,
+			CreationRateLimitOwnerKey: "owner",
+			CreationRateLimitExempt:   []string{"importer"},
+			AuthorizeRequestCallback: func(hook HookEvent) (FileInfoChanges, error) {
+				return FileInfoChanges{}, nil
+			},
+		})
+		defer os.RemoveAll(dir)
+
+		// The owner cannot be chosen by the client, whether exempt or not
+		create(http.StatusCreated, "Upload-Metadata", "owner aW1wb3J0ZXI=").Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusTooManyRequests, "Upload-Metadata", "owner aW1wb3J0ZXI=").Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusTooManyRequests, "Upload-Metadata", "owner YWxpY2U=").Run(fromAddr(handler, "10.0.0.1"), t)
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			content, _ := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+			assert.NotContains(t, string(content), "importer")
+		}
+	})
+
+	SubTest(t, "TrustedProxy", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{
+			CreationRateLimit: 0.001,
+			TrustedProxies:    []string{"192.168.0.1"},
+		})
+		defer os.RemoveAll(dir)
+
+		proxied := fromAddr(handler, "192.168.0.1")
+		create(http.StatusCreated, "X-Forwarded-For", "10.0.0.1").Run(proxied, t)
+		create(http.StatusCreated, "X-Forwarded-For", "10.0.0.2").Run(proxied, t)
+		create(http.StatusTooManyRequests, "X-Forwarded-For", "10.0.0.1").Run(proxied, t)
+	})
+
+	SubTest(t, "FailingLimiter", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		handler, dir := setup(t, Config{
+			CreationRateLimit:   0.001,
+			CreationRateLimiter: failingRateLimiter{},
+		})
+		defer os.RemoveAll(dir)
+
+		create(http.StatusCreated).Run(fromAddr(handler, "10.0.0.1"), t)
+		create(http.StatusCreated).Run(fromAddr(handler, "10.0.0.1"), t)
+	})
+}
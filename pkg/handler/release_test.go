@@ -0,0 +1,247 @@
+package handler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+func TestRequireRelease(t *testing.T) {
+	SubTest(t, "FinishScanRelease", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-release-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:          composer,
+			BasePath:               "/files/",
+			RequireRelease:         true,
+			NotifyCompleteUploads:  true,
+			AdminAuthorizeCallback: authorizeAdmin,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+				"Content-Type":  "application/offset+octet-stream",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		// The scanner learns from the notification that it has to release the upload
+		event := <-c
+		a := assert.New(t)
+		a.Equal(id, event.Upload.ID)
+		a.True(event.Upload.Unreleased)
+
+		(&httpTest{
+			Name:    "Withheld",
+			Method:  "GET",
+			URL:     id,
+			Code:    http.StatusLocked,
+			ResBody: "upload has not been released yet\n",
+			ResHeader: map[string]string{
+				"Retry-After": "",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Unauthorized",
+			Method: "PUT",
+			URL:    "admin/uploads/" + id + "/release",
+			Code:   http.StatusUnauthorized,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:   "Release",
+			Method: "PUT",
+			URL:    "admin/uploads/" + id + "/release",
+			ReqHeader: map[string]string{
+				"Authorization": "Bearer admin",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		(&httpTest{
+			Name:    "Download",
+			Method:  "GET",
+			URL:     id,
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Concat", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-release-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			BasePath:              "/files/",
+			RequireRelease:        true,
+			NotifyCompleteUploads: true,
+		})
+
+		c := make(chan HookEvent, 2)
+		handler.CompleteUploads = c
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "5",
+				"Upload-Concat": "partial",
+				"Content-Type":  "application/offset+octet-stream",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusCreated,
+		}).Run(handler, t)
+		partial := res.Header().Get("Location")
+		<-c
+
+		res = (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Concat": "final;" + partial + " " + partial,
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		event := <-c
+		a := assert.New(t)
+		a.Equal(id, event.Upload.ID)
+		a.EqualValues(10, event.Upload.Offset)
+		a.True(event.Upload.Unreleased)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    id,
+			Code:   http.StatusLocked,
+		}).Run(handler, t)
+
+		a.NoError(composer.Releaser.ReleaseUpload(context.Background(), id))
+		(&httpTest{
+			Method:  "GET",
+			URL:     id,
+			Code:    http.StatusOK,
+			ResBody: "hellohello",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NoSignedURL", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := &signableUpload{MockFullUpload: NewMockFullUpload(ctrl)}
+
+		store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+			ID:         "yes",
+			Offset:     5,
+			Size:       5,
+			Unreleased: true,
+		}, nil).Times(2)
+
+		composer.UseReleaser(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:              composer,
+			RequireRelease:             true,
+			RedirectDownloads:          true,
+			RedirectHeadRequests:       true,
+			UnreleasedUploadStatusCode: http.StatusForbidden,
+			JSONErrors:                 true,
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusForbidden,
+			ResBody: `{"code":"ERR_UPLOAD_UNRELEASED","message":"upload has not been released yet"}` + "\n",
+			ResHeader: map[string]string{
+				"Location": "",
+			},
+		}).Run(handler, t)
+
+		// HEAD requests from browsers are answered without a redirect
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Location":      "",
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+
+		assert.Equal(t, "", upload.contentType)
+	})
+
+	SubTest(t, "Disabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(context.Background()),
+		)
+
+		composer.UseReleaser(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotSupported", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer:  composer,
+			RequireRelease: true,
+		})
+		assert.EqualError(t, err, "tusd: RequireRelease requires a StoreComposer with a Releaser")
+	})
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+)
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx which carries the ID of the HTTP
+// request being handled.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the ID of the HTTP request attached to the
+// context. Data stores may use it to correlate their operations and logs with
+// the request which caused them. The ID is available if the request contained
+// the header configured by Config.RequestIDHeader or if Config.GenerateRequestIDs
+// is enabled.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// newStoreContext returns the context passed to the data store while handling
+// the request. It is intentionally not derived from the request's context, so
+// that store operations are not interrupted if the client disconnects, but it
+// carries the request's ID, if one is available.
+func newStoreContext(r *http.Request) context.Context {
+	ctx := context.Background()
+	if id, ok := RequestIDFromContext(r.Context()); ok {
+		ctx = ContextWithRequestID(ctx, id)
+	}
+
+	return ctx
+}
+
+// truncateRequestID limits the length of the request ID to 36 characters,
+// which is enough to fit a UUID.
+func truncateRequestID(id string) string {
+	if len(id) > 36 {
+		id = id[:36]
+	}
+
+	return id
+}
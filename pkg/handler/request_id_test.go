@@ -0,0 +1,126 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+// requestIDMatcher matches contexts carrying the given request ID.
+type requestIDMatcher string
+
+func (m requestIDMatcher) Matches(x interface{}) bool {
+	ctx, ok := x.(context.Context)
+	if !ok {
+		return false
+	}
+
+	id, ok := RequestIDFromContext(ctx)
+	return ok && id == string(m)
+}
+
+func (m requestIDMatcher) String() string {
+	return "is context with request ID " + string(m)
+}
+
+func TestRequestID(t *testing.T) {
+	SubTest(t, "Propagation", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(requestIDMatcher("abc"), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(requestIDMatcher("abc")).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(requestIDMatcher("abc"), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+				"X-Request-ID":  "abc",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"X-Request-ID": "abc",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Generated", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		var storeID string
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").DoAndReturn(func(ctx context.Context, id string) (Upload, error) {
+				storeID, _ = RequestIDFromContext(ctx)
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			RequestIDHeader:    "X-Correlation-ID",
+			GenerateRequestIDs: true,
+		})
+
+		res := (&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				// Only the configured header is used
+				"X-Request-ID": "abc",
+			},
+			Code: http.StatusOK,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		id := res.Header().Get("X-Correlation-ID")
+		a.Len(id, 32)
+		a.Equal(id, storeID)
+		a.Equal("", res.Header().Get("X-Request-ID"))
+	})
+
+	SubTest(t, "Truncated", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			ReqHeader: map[string]string{
+				"X-Request-ID": strings.Repeat("a", 50),
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"X-Request-ID": strings.Repeat("a", 36),
+			},
+		}).Run(handler, t)
+	})
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"io"
+	"mime"
+	"net/http"
+)
+
+// DetectedFiletypeKey is the metadata key under which the file type detected
+// from an upload's content is recorded, see Config.DetectFiletype.
+const DetectedFiletypeKey = "detected-filetype"
+
+// sniffLen is the number of bytes considered by http.DetectContentType.
+const sniffLen = 512
+
+// contentSniffer passes the bytes read from the wrapped reader on unchanged,
+// while copying the first ones into a bounded buffer for detecting the file
+// type.
+type contentSniffer struct {
+	reader io.Reader
+	buf    []byte
+}
+
+func newContentSniffer(reader io.Reader) *contentSniffer {
+	return &contentSniffer{
+		reader: reader,
+		buf:    make([]byte, 0, sniffLen),
+	}
+}
+
+func (sniffer *contentSniffer) Read(p []byte) (int, error) {
+	n, err := sniffer.reader.Read(p)
+
+	if remaining := sniffLen - len(sniffer.buf); remaining > 0 {
+		if remaining > n {
+			remaining = n
+		}
+		sniffer.buf = append(sniffer.buf, p[:remaining]...)
+	}
+
+	return n, err
+}
+
+// filetype returns the media type detected from the copied bytes, without
+// parameters such as the charset.
+func (sniffer *contentSniffer) filetype() string {
+	filetype := http.DetectContentType(sniffer.buf)
+	if mediaType, _, err := mime.ParseMediaType(filetype); err == nil {
+		filetype = mediaType
+	}
+
+	return filetype
+}
+
+// downloadFiletype returns the file type used for the Content-Type of the
+// upload's downloads. The detected one is only preferred if OverrideFiletype
+// is enabled and the content was recognized.
+func (handler *UnroutedHandler) downloadFiletype(info FileInfo) string {
+	if handler.config.OverrideFiletype {
+		if detected := info.MetaData[DetectedFiletypeKey]; detected != "" && detected != "application/octet-stream" {
+			return detected
+		}
+	}
+
+	return info.MetaData["filetype"]
+}
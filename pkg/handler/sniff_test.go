@@ -0,0 +1,246 @@
+package handler_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/tus/tusd/pkg/filestore"
+	. "github.com/tus/tusd/pkg/handler"
+)
+
+// pngHeader is the signature at the beginning of every PNG image.
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+func TestDetectFiletype(t *testing.T) {
+	SubTest(t, "FirstChunk", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+				MetaData: MetaData{
+					"filetype": "text/plain",
+				},
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(0), NewReaderMatcher(pngHeader+"hello")).Return(int64(13), nil),
+			store.EXPECT().AsMetaDataUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().SetMetaData(context.Background(), MetaData{
+				"filetype":          "text/plain",
+				"detected-filetype": "image/png",
+			}).Return(nil),
+		)
+
+		composer.UseMetaDataUpdater(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			DetectFiletype: true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader(pngHeader + "hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "13",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "LaterChunk", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(context.Background(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(context.Background()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().WriteChunk(context.Background(), int64(5), NewReaderMatcher(pngHeader)).Return(int64(8), nil),
+		)
+
+		composer.UseMetaDataUpdater(store)
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			DetectFiletype: true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader(pngHeader),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "CreationWithUpload", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		for _, override := range []bool{false, true} {
+			dir, err := ioutil.TempDir("", "tusd-sniff-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			composer := NewStoreComposer()
+			filestore.New(dir).UseIn(composer)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:    composer,
+				BasePath:         "/files/",
+				DetectFiletype:   true,
+				OverrideFiletype: override,
+			})
+
+			// The client claims a different type
+			res := (&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable":   "1.0.0",
+					"Upload-Length":   "13",
+					"Upload-Metadata": "filetype dGV4dC9wbGFpbg==",
+					"Content-Type":    "application/offset+octet-stream",
+				},
+				ReqBody: strings.NewReader(pngHeader + "hello"),
+				Code:    http.StatusCreated,
+				ResHeader: map[string]string{
+					"Upload-Offset": "13",
+				},
+			}).Run(handler, t)
+			id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+			contentType := "text/plain"
+			if override {
+				contentType = "image/png"
+			}
+
+			// The stored bytes are not altered by the sniffing
+			(&httpTest{
+				Method:  "GET",
+				URL:     id,
+				Code:    http.StatusOK,
+				ResBody: pngHeader + "hello",
+				ResHeader: map[string]string{
+					"Content-Type": contentType,
+				},
+			}).Run(handler, t)
+
+			upload, err := composer.Core.GetUpload(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := upload.GetInfo(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.MetaData["filetype"] != "text/plain" || info.MetaData["detected-filetype"] != "image/png" {
+				t.Errorf("Unexpected metadata %v", info.MetaData)
+			}
+		}
+	})
+
+	SubTest(t, "UnknownContent", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-sniff-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			DetectFiletype:   true,
+			OverrideFiletype: true,
+		})
+
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "4",
+				"Upload-Metadata": "filetype aW1hZ2UvanBlZw==",
+				"Content-Type":    "application/offset+octet-stream",
+			},
+			ReqBody: strings.NewReader("\x00\x01\x02\x03"),
+			Code:    http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		// Undetected types do not override the client's
+		(&httpTest{
+			Method: "GET",
+			URL:    id,
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type": "image/jpeg",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "ForgedType", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		dir, err := ioutil.TempDir("", "tusd-sniff-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		composer := NewStoreComposer()
+		filestore.New(dir).UseIn(composer)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			DetectFiletype:   true,
+			OverrideFiletype: true,
+		})
+
+		// The client claims to know the detected type before any content
+		res := (&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "4",
+				"Upload-Metadata": "filetype dGV4dC9wbGFpbg==,detected-filetype aW1hZ2UvcG5n",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+		id := strings.TrimPrefix(res.Header().Get("Location"), "http://tus.io/files/")
+
+		upload, err := composer.Core.GetUpload(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := upload.GetInfo(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := info.MetaData["detected-filetype"]; ok || info.MetaData["filetype"] != "text/plain" {
+			t.Errorf("Unexpected metadata %v", info.MetaData)
+		}
+	})
+}
@@ -82,6 +82,8 @@ func TestTerminate(t *testing.T) {
 		req := event.HTTPRequest
 		a.Equal("DELETE", req.Method)
 		a.Equal("foo", req.URI)
+
+		a.Equal(TerminationSourceClient, event.TerminationSource)
 	})
 
 	SubTest(t, "NotProvided", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
@@ -101,4 +103,52 @@ func TestTerminate(t *testing.T) {
 			Code: http.StatusNotImplemented,
 		}).Run(http.HandlerFunc(handler.DelFile), t)
 	})
+
+	SubTest(t, "Disabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			DisableTermination: true,
+		})
+
+		(&httpTest{
+			Method: "OPTIONS",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Tus-Extension": "creation,creation-with-upload,concatenation,creation-defer-length",
+			},
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "DELETE",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusMethodNotAllowed,
+			ResHeader: map[string]string{
+				"Allow": "POST, GET, HEAD, PATCH, OPTIONS",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DisabledForbidden", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:                 composer,
+			DisableTermination:            true,
+			TerminationDisabledStatusCode: http.StatusForbidden,
+		})
+
+		(&httpTest{
+			Method: "DELETE",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code:    http.StatusForbidden,
+			ResBody: "termination of uploads is disabled\n",
+			ResHeader: map[string]string{
+				"Allow": "",
+			},
+		}).Run(handler, t)
+	})
 }
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"sync"
+)
+
+// unfinishedUploads records the uploads whose data is complete but which could
+// not be finished, e.g. because FinishUpload failed. The next PATCH request
+// for such an upload retries finishing it, so that exactly one completion
+// event is sent. The records are only kept in memory and are therefore lost if
+// the process restarts.
+type unfinishedUploads struct {
+	mutex sync.Mutex
+	ids   map[string]struct{}
+}
+
+func newUnfinishedUploads() *unfinishedUploads {
+	return &unfinishedUploads{
+		ids: make(map[string]struct{}),
+	}
+}
+
+// add records the upload as unfinished.
+func (u *unfinishedUploads) add(id string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.ids[id] = struct{}{}
+}
+
+// take removes the upload's record and reports whether it existed, so that
+// only one request retries finishing the upload at a time.
+func (u *unfinishedUploads) take(id string) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	_, ok := u.ids[id]
+	delete(u.ids, id)
+	return ok
+}
@@ -3,8 +3,11 @@ package handler
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"math"
 	"net"
@@ -13,6 +16,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/tus/tusd/internal/uid"
 )
 
 const UploadLengthDeferred = "1"
@@ -70,9 +75,34 @@ var (
 	ErrUploadLengthAndUploadDeferLength = NewHTTPError(errors.New("provided both Upload-Length and Upload-Defer-Length"), http.StatusBadRequest)
 	ErrInvalidUploadDeferLength         = NewHTTPError(errors.New("invalid Upload-Defer-Length header"), http.StatusBadRequest)
 	ErrUploadStoppedByServer            = NewHTTPError(errors.New("upload has been stopped by server"), http.StatusBadRequest)
+	ErrIncompleteUpload                 = NewHTTPError(errors.New("upload has not been finished yet"), http.StatusConflict)
+	ErrRangeNotSatisfiable              = NewHTTPError(errors.New("requested range not satisfiable"), http.StatusRequestedRangeNotSatisfiable)
+	ErrUploadExpired                    = NewHTTPError(errors.New("upload has expired"), http.StatusGone)
+	ErrUploadBusy                       = NewHTTPError(errors.New("upload is busy with another request"), http.StatusServiceUnavailable)
+	ErrIncompleteBody                   = NewHTTPError(errors.New("request body is shorter than Content-Length"), http.StatusBadRequest)
+	ErrUploadDeadlineExceeded           = NewHTTPError(errors.New("upload has not been completed in time"), http.StatusGone)
+	ErrUnsupportedChecksumAlgorithm     = NewHTTPError(errors.New("unsupported checksum algorithm"), http.StatusBadRequest)
+	ErrInvalidChecksum                  = NewHTTPError(errors.New("invalid or missing Upload-Checksum"), http.StatusBadRequest)
+	ErrChecksumMismatch                 = NewHTTPError(errors.New("checksum mismatch"), 460)
+	ErrChecksumChunkTooLarge            = NewHTTPError(errors.New("chunk with checksum exceeds the maximum chunk size"), http.StatusRequestEntityTooLarge)
+	ErrIdempotencyKeyMismatch           = NewHTTPError(errors.New("Idempotency-Key has already been used for a different upload"), http.StatusUnprocessableEntity)
+	ErrIdempotencyKeyInUse              = NewHTTPError(errors.New("request with the same Idempotency-Key is in progress"), http.StatusConflict)
+	ErrInvalidListQuery                 = NewHTTPError(errors.New("invalid query for listing uploads"), http.StatusBadRequest)
+	ErrRateLimited                      = NewHTTPError(errors.New("too many uploads created, retry later"), http.StatusTooManyRequests)
 
 	errReadTimeout     = errors.New("read tcp: i/o timeout")
 	errConnectionReset = errors.New("read tcp: connection reset by peer")
+
+	errTerminationDisabled = errors.New("termination of uploads is disabled")
+	errUploadOnHold        = errors.New("upload is on hold")
+	errUploadUnreleased    = errors.New("upload has not been released yet")
+)
+
+// The codes of the errors whose status code is configurable, see
+// uploadOnHoldError and uploadUnreleasedError.
+const (
+	errCodeUploadOnHold     = "ERR_UPLOAD_ON_HOLD"
+	errCodeUploadUnreleased = "ERR_UPLOAD_UNRELEASED"
 )
 
 // HTTPRequest contains basic details of an incoming HTTP request.
@@ -95,11 +125,44 @@ type HookEvent struct {
 	// HTTPRequest contains details about the HTTP request that reached
 	// tusd.
 	HTTPRequest HTTPRequest
+	// Context is the context of the HTTP request that caused this hook to be
+	// fired. It may be used to access values attached by middlewares, such as
+	// the authenticated user. It is not included in serialized hook payloads.
+	Context context.Context `json:"-"`
+	// TerminationSource describes what caused the upload to be terminated. It is
+	// only set for events sent on the TerminatedUploads channel.
+	TerminationSource TerminationSource `json:",omitempty"`
+}
+
+// TerminationSource describes what caused an upload to be terminated.
+type TerminationSource string
+
+const (
+	// TerminationSourceClient is used for uploads terminated by the client
+	// using a DELETE request.
+	TerminationSourceClient TerminationSource = "client"
+	// TerminationSourceServer is used for uploads terminated by the handler
+	// itself, e.g. after they have been stopped using FileInfo.StopUpload or
+	// their creation failed.
+	TerminationSourceServer TerminationSource = "server"
+)
+
+// completeUploadsBufferSize is the number of events the CompleteUploads
+// channel holds before further events are dropped.
+const completeUploadsBufferSize = 64
+
+// FileInfoChanges collects changes which a callback wants to apply to an
+// upload's FileInfo before it is passed on to the data store.
+type FileInfoChanges struct {
+	// If MetaData is not nil, it replaces the upload's entire metadata. Keys
+	// which should be retained must therefore be copied over.
+	MetaData MetaData
 }
 
 func newHookEvent(info FileInfo, r *http.Request) HookEvent {
 	return HookEvent{
-		Upload: info,
+		Upload:  info,
+		Context: r.Context(),
 		HTTPRequest: HTTPRequest{
 			Method:     r.Method,
 			URI:        r.RequestURI,
@@ -119,13 +182,26 @@ type UnroutedHandler struct {
 	basePath      string
 	logger        *log.Logger
 	extensions    string
+	queue         *uploadQueue
+	unfinished    *unfinishedUploads
+	idempotency   *idempotencyIndex
+	// now returns the current time, against which expiry and deadlines are
+	// checked, and is replaced in tests.
+	now func() time.Time
 
 	// CompleteUploads is used to send notifications whenever an upload is
 	// completed by a user. The HookEvent will contain information about this
-	// upload after it is completed. Sending to this channel will only
+	// upload after it is completed, as reported by the data store once
+	// FinishUpload has succeeded. Sending to this channel will only
 	// happen if the NotifyCompleteUploads field is set to true in the Config
 	// structure. Notifications will also be sent for completions using the
-	// Concatenation extension.
+	// Concatenation extension. The channel buffers up to
+	// completeUploadsBufferSize events. If the channel's consumer falls
+	// further behind, events are dropped instead of delaying the responses to
+	// the clients, see Metrics.CompletionsDropped. Events are sent in the
+	// order in which the uploads have been finished. If a request fails to
+	// finish the upload, e.g. because FinishUpload fails, the next PATCH
+	// request retries it, so that only one event is sent.
 	CompleteUploads chan HookEvent
 	// TerminatedUploads is used to send notifications whenever an upload is
 	// terminated by a user. The HookEvent will contain information about this
@@ -163,7 +239,7 @@ func NewUnroutedHandler(config Config) (*UnroutedHandler, error) {
 
 	// Only promote extesions using the Tus-Extension header which are implemented
 	extensions := "creation,creation-with-upload"
-	if config.StoreComposer.UsesTerminater {
+	if config.StoreComposer.UsesTerminater && !config.DisableTermination {
 		extensions += ",termination"
 	}
 	if config.StoreComposer.UsesConcater {
@@ -172,19 +248,32 @@ func NewUnroutedHandler(config Config) (*UnroutedHandler, error) {
 	if config.StoreComposer.UsesLengthDeferrer {
 		extensions += ",creation-defer-length"
 	}
+	if config.StoreComposer.UsesExpirer {
+		extensions += ",expiration"
+	}
+	if config.StoreComposer.UsesTruncater {
+		extensions += ",checksum,checksum-trailer"
+	}
 
 	handler := &UnroutedHandler{
 		config:            config,
 		composer:          config.StoreComposer,
 		basePath:          config.BasePath,
 		isBasePathAbs:     config.isAbs,
-		CompleteUploads:   make(chan HookEvent),
+		CompleteUploads:   make(chan HookEvent, completeUploadsBufferSize),
 		TerminatedUploads: make(chan HookEvent),
 		UploadProgress:    make(chan HookEvent),
 		CreatedUploads:    make(chan HookEvent),
 		logger:            config.Logger,
 		extensions:        extensions,
-		Metrics:           newMetrics(),
+		queue:             newUploadQueue(),
+		unfinished:        newUnfinishedUploads(),
+		now:               time.Now,
+		Metrics:           newMetrics(config.ChunkSizeBuckets, config.PatchDurationBuckets),
+	}
+
+	if config.IdempotencyKeyWindow > 0 {
+		handler.idempotency = newIdempotencyIndex(config.IdempotencyKeyWindow)
 	}
 
 	return handler, nil
@@ -204,11 +293,30 @@ func (handler *UnroutedHandler) SupportedExtensions() string {
 // this middleware.
 func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			handler.Metrics.incRequestsHandled(recorder.handledRequest(r.Method, handler.config.StoreName), time.Since(start))
+		}()
+
 		// Allow overriding the HTTP method. The reason for this is
 		// that some libraries/environments to not support PATCH and
 		// DELETE requests, e.g. Flash in a browser and parts of Java
-		if newMethod := r.Header.Get("X-HTTP-Method-Override"); newMethod != "" {
-			r.Method = newMethod
+		if r.Method == "POST" {
+			r.Method = overriddenMethod(r)
+		}
+
+		// Attach the request's ID to its context, so that it is available to the
+		// handler and the data store, and echo it, so that clients can correlate
+		// their requests with our logs.
+		reqId := truncateRequestID(r.Header.Get(handler.config.RequestIDHeader))
+		if reqId == "" && handler.config.GenerateRequestIDs {
+			reqId = uid.Uid()
+		}
+		if reqId != "" {
+			r = r.WithContext(ContextWithRequestID(r.Context(), reqId))
+			w.Header().Set(handler.config.RequestIDHeader, reqId)
 		}
 
 		handler.log("RequestIncoming", "method", r.Method, "path", r.URL.Path, "requestId", getRequestId(r))
@@ -223,12 +331,16 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 			if r.Method == "OPTIONS" {
 				// Preflight request
 				header.Add("Access-Control-Allow-Methods", "POST, GET, HEAD, PATCH, DELETE, OPTIONS")
-				header.Add("Access-Control-Allow-Headers", "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat")
+				header.Add("Access-Control-Allow-Headers", "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, X-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Checksum, Upload-Checksum-Algorithm, Idempotency-Key")
 				header.Set("Access-Control-Max-Age", "86400")
 
 			} else {
 				// Actual request
-				header.Add("Access-Control-Expose-Headers", "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat")
+				header.Add("Access-Control-Expose-Headers", "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Expires, Tus-Checksum-Algorithm, Idempotent-Replayed, Upload-On-Hold")
+				header.Add("Access-Control-Expose-Headers", handler.config.RequestIDHeader)
+				for _, field := range handler.config.ExposedStorageFields {
+					header.Add("Access-Control-Expose-Headers", storageHeaderName(field))
+				}
 			}
 		}
 
@@ -247,6 +359,9 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 
 			header.Set("Tus-Version", "1.0.0")
 			header.Set("Tus-Extension", handler.extensions)
+			if handler.composer.UsesTruncater {
+				header.Set("Tus-Checksum-Algorithm", supportedChecksumAlgorithms)
+			}
 
 			// Although the 204 No Content status code is a better fit in this case,
 			// since we do not have a response body included, we cannot use it here
@@ -262,7 +377,8 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 		// Test if the version sent by the client is supported
 		// GET and HEAD methods are not checked since a browser may visit this URL and does
 		// not include this header. GET requests are not part of the specification.
-		if r.Method != "GET" && r.Method != "HEAD" && r.Header.Get("Tus-Resumable") != "1.0.0" {
+		// Neither is the admin endpoint.
+		if r.Method != "GET" && r.Method != "HEAD" && !handler.isAdminPath(r.URL.Path) && r.Header.Get("Tus-Resumable") != "1.0.0" {
 			handler.sendError(w, r, ErrUnsupportedVersion)
 			return
 		}
@@ -272,10 +388,84 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 	})
 }
 
+// overriddenMethod returns the method requested by the X-HTTP-Method-Override
+// or X-Method-Override header of a POST request. Only methods which are
+// handled by tusd may be requested, other values are ignored.
+func overriddenMethod(r *http.Request) string {
+	newMethod := r.Header.Get("X-HTTP-Method-Override")
+	if newMethod == "" {
+		newMethod = r.Header.Get("X-Method-Override")
+	}
+
+	switch newMethod = strings.ToUpper(newMethod); newMethod {
+	case "GET", "HEAD", "PATCH", "DELETE", "OPTIONS":
+		return newMethod
+	default:
+		return r.Method
+	}
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code of
+// the response for the metrics.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	// errorCode is the code of the error sent by sendError, if any.
+	errorCode string
+}
+
+// handledRequest describes the request for the metrics. Responses for which
+// the status has not been written explicitly are sent with 200 OK.
+func (w *statusRecorder) handledRequest(method string, store string) HandledRequest {
+	req := HandledRequest{
+		Method:     method,
+		StatusCode: w.statusCode,
+		Outcome:    "success",
+		Store:      store,
+	}
+	if req.StatusCode == 0 {
+		req.StatusCode = http.StatusOK
+	}
+	if req.StatusCode >= 400 {
+		req.Outcome = "error"
+		if w.errorCode != "" {
+			req.Outcome = w.errorCode
+		}
+	}
+
+	return req
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped http.ResponseWriter does.
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // PostFile creates a new file upload using the datastore after validating the
 // length and parsing the metadata.
 func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := newStoreContext(r)
 
 	// Check for presence of application/offset+octet-stream. If another content
 	// type is defined, it will be ignored and treated as none was set because
@@ -309,7 +499,7 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		partialUploads, size, err = handler.sizeOfUploads(ctx, partialUploadIDs)
+		partialUploads, size, err = handler.sizeOfUploads(ctx, r, partialUploadIDs)
 		if err != nil {
 			handler.sendError(w, r, err)
 			return
@@ -331,7 +521,24 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Parse metadata
-	meta := ParseMetadataHeader(r.Header.Get("Upload-Metadata"))
+	meta, err := handler.parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	// The fingerprint of retried creation requests only covers the properties
+	// chosen by the client
+	fingerprint := idempotencyFingerprint(FileInfo{
+		Size:           size,
+		SizeIsDeferred: sizeIsDeferred,
+		MetaData:       meta,
+		IsPartial:      isPartial,
+		IsFinal:        isFinal,
+		PartialUploads: partialUploadIDs,
+	})
+
+	handler.recordRequestMetadata(meta, r)
 
 	info := FileInfo{
 		Size:           size,
@@ -342,11 +549,58 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		PartialUploads: partialUploadIDs,
 	}
 
+	// The owner to which the rate limit applies may only be recorded by the
+	// authorization, never by the client.
+	var owner string
+	if handler.config.AuthorizeRequestCallback != nil {
+		changes, err := handler.config.AuthorizeRequestCallback(newHookEvent(info, r))
+		if err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+
+		if changes.MetaData != nil {
+			info.MetaData = changes.MetaData
+			if key := handler.config.CreationRateLimitOwnerKey; key != "" {
+				owner = changes.MetaData[key]
+			}
+		}
+	}
+
+	// Answer retried creation requests with the upload created by the first
+	// request instead of creating another one.
+	var idempotencyKey string
+	if handler.idempotency != nil && r.Header.Get("Idempotency-Key") != "" {
+		idempotencyKey = handler.idempotencyKey(r, owner)
+
+		replayed, err := handler.replayCreation(ctx, w, r, idempotencyKey, fingerprint)
+		if err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+		if replayed {
+			return
+		}
+
+		// The key is only released if the upload could not be created
+		defer handler.idempotency.release(idempotencyKey)
+	}
+
+	if err := handler.limitCreation(r, owner); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
 	if handler.config.PreUploadCreateCallback != nil {
-		if err := handler.config.PreUploadCreateCallback(newHookEvent(info, r)); err != nil {
+		changes, err := handler.config.PreUploadCreateCallback(newHookEvent(info, r))
+		if err != nil {
 			handler.sendError(w, r, err)
 			return
 		}
+
+		if changes.MetaData != nil {
+			info.MetaData = changes.MetaData
+		}
 	}
 
 	upload, err := handler.composer.Core.NewUpload(ctx, info)
@@ -363,10 +617,20 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 
 	id := info.ID
 
+	if idempotencyKey != "" {
+		handler.idempotency.commit(idempotencyKey, id)
+	}
+
 	// Add the Location header directly after creating the new resource to even
 	// include it in cases of failure when an error is returned
 	url := handler.absFileURL(r, id)
 	w.Header().Set("Location", url)
+	handler.setStorageHeaders(w, info)
+
+	if _, err := handler.setExpiresHeader(ctx, w, upload); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
 
 	handler.Metrics.incUploadsCreated()
 	handler.log("UploadCreated", "id", id, "size", i64toa(size), "url", url)
@@ -376,20 +640,49 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	if isFinal {
+		// The final upload is complete once its content has been concatenated,
+		// so it must be withheld from downloads before.
+		if handler.config.RequireRelease {
+			if err := handler.composer.Releaser.WithholdUpload(ctx, id); err != nil {
+				handler.sendError(w, r, err)
+				return
+			}
+		}
+
 		concatableUpload := handler.composer.Concater.AsConcatableUpload(upload)
 		if err := concatableUpload.ConcatUploads(ctx, partialUploads); err != nil {
 			handler.sendError(w, r, err)
 			return
 		}
+		if handler.config.NotifyCompleteUploads {
+			info = handler.finishedUploadInfo(ctx, upload, info)
+		}
+		// The info may have been fetched before the concatenation and withholding
 		info.Offset = size
-
+		if handler.config.RequireRelease {
+			info.Unreleased = true
+		}
 		if handler.config.NotifyCompleteUploads {
-			handler.CompleteUploads <- newHookEvent(info, r)
+			handler.notifyCompleteUpload(newHookEvent(info, r))
 		}
 	}
 
-	if containsChunk {
-		if handler.composer.UsesLocker {
+	if !isFinal && !sizeIsDeferred && info.Offset == size {
+		// Directly finish the upload if the data store already holds all of its
+		// data. This is the case for empty uploads (i.e. with a size of 0) but
+		// also if the data store has deduplicated the upload's content. The
+		// client learns from the offset that it does not need to transfer
+		// anything, so a chunk in this request is ignored. This statement comes
+		// first to avoid causing duplicate calls to finishUploadIfComplete.
+		info.Size = size
+		w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+
+		if err := handler.finishUploadIfComplete(ctx, upload, info, r); err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+	} else if containsChunk {
+		if handler.locksUploads() {
 			lock, err := handler.lockUpload(id)
 			if err != nil {
 				handler.sendError(w, r, err)
@@ -399,15 +692,8 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 			defer lock.Unlock()
 		}
 
-		if err := handler.writeChunk(ctx, upload, info, w, r); err != nil {
-			handler.sendError(w, r, err)
-			return
-		}
-	} else if !sizeIsDeferred && size == 0 {
-		// Directly finish the upload if the upload is empty (i.e. has a size of 0).
-		// This statement is in an else-if block to avoid causing duplicate calls
-		// to finishUploadIfComplete if an upload is empty and contains a chunk.
-		if err := handler.finishUploadIfComplete(ctx, upload, info, r); err != nil {
+		if _, err := handler.writeChunk(ctx, upload, info, w, r); err != nil {
+			handler.cleanupFailedCreation(ctx, upload, info, w, r)
 			handler.sendError(w, r, err)
 			return
 		}
@@ -416,9 +702,79 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	handler.sendResp(w, r, http.StatusCreated)
 }
 
+// replayCreation answers a creation request whose Idempotency-Key has already
+// been used within the window with the upload created back then, including
+// its current offset. A chunk in the request is not written, since the first
+// request may have stored it already. Instead, the client resumes the upload
+// from the offset. If the key is new, it is reserved and false is returned, so
+// the upload is created as usual.
+func (handler *UnroutedHandler) replayCreation(ctx context.Context, w http.ResponseWriter, r *http.Request, key string, fingerprint string) (bool, error) {
+	id, err := handler.idempotency.reserve(key, fingerprint, handler.now())
+	if err != nil || id == "" {
+		return false, err
+	}
+
+	upload, err := handler.composer.Core.GetUpload(ctx, id)
+	if err == ErrNotFound {
+		// The upload has been terminated in the meantime, so a new one is created
+		handler.idempotency.forget(key)
+		return handler.replayCreation(ctx, w, r, key, fingerprint)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := handler.authorizeRequest(info, r); err != nil {
+		return false, err
+	}
+
+	url := handler.absFileURL(r, id)
+	w.Header().Set("Location", url)
+	handler.setStorageHeaders(w, info)
+
+	if _, err := handler.setExpiresHeader(ctx, w, upload); err != nil {
+		return false, err
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	w.Header().Set("Idempotent-Replayed", "true")
+
+	handler.log("UploadCreationReplayed", "id", id, "url", url)
+	handler.sendResp(w, r, http.StatusCreated)
+	return true, nil
+}
+
+// cleanupFailedCreation terminates an upload whose creation request contained
+// a chunk which could not be stored at all. Since the client will not be able
+// to learn about the upload's URL from the error response, the upload would
+// otherwise remain as an orphan. If any data has been stored, the upload is
+// kept, so it can be resumed.
+func (handler *UnroutedHandler) cleanupFailedCreation(ctx context.Context, upload Upload, info FileInfo, w http.ResponseWriter, r *http.Request) {
+	if !handler.composer.UsesTerminater {
+		return
+	}
+
+	currentInfo, err := upload.GetInfo(ctx)
+	if err != nil || currentInfo.Offset != 0 {
+		return
+	}
+
+	if err := handler.terminateUpload(ctx, upload, currentInfo, r, TerminationSourceServer); err != nil {
+		handler.log("UploadCleanupError", "id", info.ID, "error", err.Error())
+		return
+	}
+
+	w.Header().Del("Location")
+}
+
 // HeadFile returns the length and offset for the HEAD request
 func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := newStoreContext(r)
 
 	id, err := extractIDFromPath(r.URL.Path)
 	if err != nil {
@@ -426,7 +782,7 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if handler.composer.UsesLocker {
+	if handler.locksUploads() {
 		lock, err := handler.lockUpload(id)
 		if err != nil {
 			handler.sendError(w, r, err)
@@ -448,6 +804,19 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if err := handler.authorizeRequest(info, r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	// Browsers and other non-tus clients may use HEAD requests in preparation
+	// for a download, which should be redirected in the same way as the GET.
+	if handler.config.RedirectHeadRequests && r.Header.Get("Tus-Resumable") == "" {
+		if handler.redirectDownload(ctx, w, r, upload, info) {
+			return
+		}
+	}
+
 	// Add Upload-Concat header if possible
 	if info.IsPartial {
 		w.Header().Set("Upload-Concat", "partial")
@@ -468,6 +837,13 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		w.Header().Set("Upload-Metadata", SerializeMetadataHeader(info.MetaData))
 	}
 
+	handler.setStorageHeaders(w, info)
+
+	if _, err := handler.setExpiresHeader(ctx, w, upload); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
 	if info.SizeIsDeferred {
 		w.Header().Set("Upload-Defer-Length", UploadLengthDeferred)
 	} else {
@@ -475,6 +851,11 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
 	}
 
+	// Let clients polling the upload know why it cannot be resumed
+	if info.OnHold {
+		w.Header().Set("Upload-On-Hold", "true")
+	}
+
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
 	handler.sendResp(w, r, http.StatusOK)
@@ -483,7 +864,15 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 // PatchFile adds a chunk to an upload. This operation is only allowed
 // if enough space in the upload is left.
 func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := newStoreContext(r)
+
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w}
+	w = recorder
+	var stats chunkStats
+	defer func() {
+		handler.Metrics.observePatch(recorder.statusCode, stats, time.Since(start))
+	}()
 
 	// Check for presence of application/offset+octet-stream
 	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
@@ -504,7 +893,7 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if handler.composer.UsesLocker {
+	if handler.locksUploads() {
 		lock, err := handler.lockUpload(id)
 		if err != nil {
 			handler.sendError(w, r, err)
@@ -526,19 +915,58 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if err := handler.authorizeRequest(info, r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
 	// Modifying a final upload is not allowed
 	if info.IsFinal {
 		handler.sendError(w, r, ErrModifyFinal)
 		return
 	}
 
+	if info.OnHold {
+		handler.sendError(w, r, handler.uploadOnHoldError())
+		return
+	}
+
+	expiresAt, err := handler.setExpiresHeader(ctx, w, upload)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	if !expiresAt.IsZero() && !handler.now().Before(expiresAt) {
+		handler.sendError(w, r, ErrUploadExpired)
+		return
+	}
+
+	if handler.deadlineExceeded(info) {
+		handler.sendError(w, r, ErrUploadDeadlineExceeded)
+		return
+	}
+
 	if offset != info.Offset {
+		// Tell the client where to continue, so it does not need to send a HEAD
+		// request first. The offset is going to change, so it must not be cached.
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
 		handler.sendError(w, r, ErrMismatchOffset)
 		return
 	}
 
 	// Do not proxy the call to the data store if the upload is already completed
 	if !info.SizeIsDeferred && info.Offset == info.Size {
+		// A previous request may have stored all data but failed to finish the
+		// upload, which is retried now
+		if handler.unfinished.take(id) {
+			if err := handler.finishUploadIfComplete(ctx, upload, info, r); err != nil {
+				handler.sendError(w, r, err)
+				return
+			}
+		}
+
 		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
 		handler.sendResp(w, r, http.StatusNoContent)
 		return
@@ -569,7 +997,8 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		info.SizeIsDeferred = false
 	}
 
-	if err := handler.writeChunk(ctx, upload, info, w, r); err != nil {
+	stats, err = handler.writeChunk(ctx, upload, info, w, r)
+	if err != nil {
 		handler.sendError(w, r, err)
 		return
 	}
@@ -577,10 +1006,82 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 	handler.sendResp(w, r, http.StatusNoContent)
 }
 
+// setStorageHeaders adds a header for each entry of the upload's storage
+// details which is allowed to be exposed by the ExposedStorageFields option.
+func (handler *UnroutedHandler) setStorageHeaders(w http.ResponseWriter, info FileInfo) {
+	for _, field := range handler.config.ExposedStorageFields {
+		if value, ok := info.Storage[field]; ok {
+			w.Header().Set(storageHeaderName(field), value)
+		}
+	}
+}
+
+// storageHeaderName returns the name of the header used for exposing the
+// storage details' entry.
+func storageHeaderName(field string) string {
+	return http.CanonicalHeaderKey("X-Upload-Storage-" + field)
+}
+
+// uploadOnHoldError returns the error for rejecting requests to modify an upload
+// which has been put on hold.
+func (handler *UnroutedHandler) uploadOnHoldError() error {
+	return codedError{NewHTTPError(errUploadOnHold, handler.config.HeldUploadStatusCode), errCodeUploadOnHold}
+}
+
+// uploadUnreleasedError returns the error for rejecting downloads of uploads
+// which have not been released yet.
+func (handler *UnroutedHandler) uploadUnreleasedError() error {
+	return codedError{NewHTTPError(errUploadUnreleased, handler.config.UnreleasedUploadStatusCode), errCodeUploadUnreleased}
+}
+
+// deadlineExceeded checks whether the upload has not been completed within
+// MaxUploadDuration after its creation. Uploads for which the data store does
+// not record the creation time never exceed the deadline.
+func (handler *UnroutedHandler) deadlineExceeded(info FileInfo) bool {
+	if handler.config.MaxUploadDuration <= 0 || info.CreatedAt == nil {
+		return false
+	}
+
+	return !handler.now().Before(info.CreatedAt.Add(handler.config.MaxUploadDuration))
+}
+
+// setExpiresHeader retrieves the point in time at which the upload expires, if
+// the data store supports the Expiration extension, and sets the
+// Upload-Expires header accordingly. A zero time is returned for uploads which
+// do not expire.
+func (handler *UnroutedHandler) setExpiresHeader(ctx context.Context, w http.ResponseWriter, upload Upload) (time.Time, error) {
+	if !handler.composer.UsesExpirer {
+		return time.Time{}, nil
+	}
+
+	expirableUpload := handler.composer.Expirer.AsExpirableUpload(upload)
+	expiresAt, err := expirableUpload.ExpiresAt(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if !expiresAt.IsZero() {
+		w.Header().Set("Upload-Expires", expiresAt.UTC().Format(http.TimeFormat))
+	}
+
+	return expiresAt, nil
+}
+
+// chunkStats describes the chunk written by a request for the metrics.
+type chunkStats struct {
+	bytesWritten int64
+	// cutOff indicates that the body has been cut off at the MaxChunkSize.
+	cutOff bool
+	// completed indicates that the upload has been finished.
+	completed bool
+}
+
 // writeChunk reads the body from the requests r and appends it to the upload
 // with the corresponding id. Afterwards, it will set the necessary response
 // headers but will not send the response.
-func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, info FileInfo, w http.ResponseWriter, r *http.Request) error {
+func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, info FileInfo, w http.ResponseWriter, r *http.Request) (chunkStats, error) {
+	var stats chunkStats
+
 	// Get Content-Length if possible
 	length := r.ContentLength
 	offset := info.Offset
@@ -588,13 +1089,14 @@ func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, i
 
 	// Test if this upload fits into the file's size
 	if !info.SizeIsDeferred && offset+length > info.Size {
-		return ErrSizeExceeded
+		return stats, ErrSizeExceeded
 	}
 
 	maxSize := info.Size - offset
-	// If the upload's length is deferred and the PATCH request does not contain the Content-Length
-	// header (which is allowed if 'Transfer-Encoding: chunked' is used), we still need to set limits for
-	// the body size.
+	// If the upload's length is deferred, we still need to set limits for the
+	// body size, even if the request contains a larger Content-Length header or
+	// none at all (which is allowed if 'Transfer-Encoding: chunked' is used).
+	// The body is then cut off once the maximum upload size is reached.
 	if info.SizeIsDeferred {
 		if handler.config.MaxSize > 0 {
 			// Ensure that the upload does not exceed the maximum upload size
@@ -604,19 +1106,53 @@ func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, i
 			maxSize = math.MaxInt64
 		}
 	}
-	if length > 0 {
+	if length > 0 && length < maxSize {
 		maxSize = length
 	}
+	// A deferred-length upload which already reached the maximum size cannot
+	// accept any further bytes.
+	if maxSize <= 0 && length != 0 && info.SizeIsDeferred {
+		return stats, ErrMaxSizeExceeded
+	}
+	// Cut the body off at the maximum chunk size. The data store sees a regular
+	// end of the body and the client continues from the returned offset.
+	cappedAtChunkSize := false
+	if handler.config.MaxChunkSize > 0 && maxSize > handler.config.MaxChunkSize {
+		maxSize = handler.config.MaxChunkSize
+		cappedAtChunkSize = true
+	}
+
+	checksum, err := parseChecksum(r)
+	if err != nil {
+		return stats, err
+	}
+	if checksum != nil && !handler.composer.UsesTruncater {
+		return stats, ErrNotImplemented
+	}
+	// The checksum covers the entire body, so it cannot be verified for the
+	// part which is accepted if the body is cut off.
+	if checksum != nil && length > maxSize {
+		return stats, ErrChecksumChunkTooLarge
+	}
 
 	handler.log("ChunkWriteStart", "id", id, "maxSize", i64toa(maxSize), "offset", i64toa(offset))
 
 	var bytesWritten int64
-	var err error
+	var bodyCutOff bool
+	var sniffer *contentSniffer
 	// Prevent a nil pointer dereference when accessing the body which may not be
 	// available in the case of a malicious request.
 	if r.Body != nil {
 		// Limit the data read from the request's body to the allowed maximum
-		reader := newBodyReader(io.LimitReader(r.Body, maxSize))
+		var body io.Reader = io.LimitReader(r.Body, maxSize)
+		if checksum != nil {
+			body = checksum.wrap(body)
+		}
+		if handler.config.DetectFiletype && offset == 0 {
+			sniffer = newContentSniffer(body)
+			body = sniffer
+		}
+		reader := newBodyReader(body)
 
 		// We use a context object to allow the hook system to cancel an upload
 		uploadCtx, stopUpload := context.WithCancel(context.Background())
@@ -640,9 +1176,11 @@ func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, i
 			defer close(stopProgressEvents)
 		}
 
+		handler.Metrics.incChunkWritesInProgress()
 		bytesWritten, err = upload.WriteChunk(ctx, offset, reader)
+		handler.Metrics.decChunkWritesInProgress()
 		if terminateUpload && handler.composer.UsesTerminater {
-			if terminateErr := handler.terminateUpload(ctx, upload, info, r); terminateErr != nil {
+			if terminateErr := handler.terminateUpload(ctx, upload, info, r, TerminationSourceServer); terminateErr != nil {
 				// We only log this error and not show it to the user since this
 				// termination error is not relevant to the uploading client
 				handler.log("UploadStopTerminateError", "id", id, "error", terminateErr.Error())
@@ -653,11 +1191,34 @@ func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, i
 		// it in the response, if the store did not also return an error.
 		if bodyErr := reader.hasError(); bodyErr != nil {
 			handler.log("BodyReadError", "id", id, "error", bodyErr.Error())
-			if err == nil {
+			// The server reports a body which ended before the announced
+			// Content-Length as an unexpected EOF, which is an incomplete body.
+			if err == nil && errors.Is(bodyErr, io.ErrUnexpectedEOF) {
+				w.Header().Set("Upload-Offset", strconv.FormatInt(offset+bytesWritten, 10))
+				err = ErrIncompleteBody
+			} else if err == nil {
 				err = bodyErr
 			}
 		}
 
+		// A body which ended before reaching the announced Content-Length indicates
+		// an interrupted transfer, which must not look like a successful chunk.
+		// The stored bytes are kept and reported, so the client can resume.
+		if err == nil && length > 0 && maxSize == length && reader.bytesRead() < length {
+			handler.log("ChunkIncomplete", "id", id, "expected", i64toa(length), "received", i64toa(reader.bytesRead()))
+			w.Header().Set("Upload-Offset", strconv.FormatInt(offset+bytesWritten, 10))
+			err = ErrIncompleteBody
+		}
+
+		// A body without Content-Length has only been cut off if it continues
+		// after the limit.
+		if err == nil && length < 0 && reader.bytesRead() == maxSize && (cappedAtChunkSize || checksum != nil) {
+			bodyCutOff = bodyContinues(r.Body)
+		}
+		if err == nil && cappedAtChunkSize {
+			stats.cutOff = length > maxSize || bodyCutOff
+		}
+
 		// If the upload was stopped by the server, send an error response indicating this.
 		// TODO: Include a custom reason for the end user why the upload was stopped.
 		if terminateUpload {
@@ -666,18 +1227,79 @@ func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, i
 	}
 
 	handler.log("ChunkWriteComplete", "id", id, "bytesWritten", i64toa(bytesWritten))
+	stats.bytesWritten = bytesWritten
+
+	// Count the bytes reported by the data store even if the write failed, since
+	// they may have been stored nevertheless.
+	if bytesWritten > 0 {
+		handler.Metrics.incBytesReceived(uint64(bytesWritten))
+	}
+
+	// The chunk has already been stored when its checksum can be verified, so it
+	// must be removed again if it does not match or the body has been cut off.
+	if err == nil && checksum != nil {
+		if bodyCutOff {
+			err = ErrChecksumChunkTooLarge
+		} else if err = checksum.verify(r); err != nil {
+			handler.log("ChecksumMismatch", "id", id, "algorithm", checksum.algorithm, "error", err.Error())
+		}
+
+		if err != nil {
+			truncatableUpload := handler.composer.Truncater.AsTruncatableUpload(upload)
+			if truncateErr := truncatableUpload.Truncate(ctx, offset); truncateErr != nil {
+				handler.log("ChunkTruncateError", "id", id, "error", truncateErr.Error())
+				return stats, truncateErr
+			}
+		}
+	}
 
 	if err != nil {
-		return err
+		return stats, err
+	}
+
+	if sniffer != nil && bytesWritten > 0 {
+		handler.recordDetectedFiletype(ctx, upload, &info, sniffer.filetype())
 	}
 
 	// Send new offset to client
 	newOffset := offset + bytesWritten
 	w.Header().Set("Upload-Offset", strconv.FormatInt(newOffset, 10))
-	handler.Metrics.incBytesReceived(uint64(bytesWritten))
 	info.Offset = newOffset
 
-	return handler.finishUploadIfComplete(ctx, upload, info, r)
+	if err := handler.finishUploadIfComplete(ctx, upload, info, r); err != nil {
+		return stats, err
+	}
+
+	stats.completed = !info.SizeIsDeferred && info.Offset == info.Size
+	return stats, nil
+}
+
+// bodyContinues checks whether more bytes can be read from the body. The read
+// byte is discarded, so this must only be used once the body is not needed
+// anymore.
+func bodyContinues(body io.Reader) bool {
+	n, _ := body.Read(make([]byte, 1))
+	return n > 0
+}
+
+// recordDetectedFiletype stores the file type detected from the upload's first
+// chunk in its metadata. The chunk has already been stored at this point, so a
+// failure is only logged instead of failing the request.
+func (handler *UnroutedHandler) recordDetectedFiletype(ctx context.Context, upload Upload, info *FileInfo, filetype string) {
+	meta := make(MetaData, len(info.MetaData)+1)
+	for key, value := range info.MetaData {
+		meta[key] = value
+	}
+	meta[DetectedFiletypeKey] = filetype
+
+	updatableUpload := handler.composer.MetaDataUpdater.AsMetaDataUpdatableUpload(upload)
+	if err := updatableUpload.SetMetaData(ctx, meta); err != nil {
+		handler.log("FiletypeDetectionError", "id", info.ID, "error", err.Error())
+		return
+	}
+
+	handler.log("FiletypeDetected", "id", info.ID, "filetype", filetype, "clientFiletype", info.MetaData["filetype"])
+	info.MetaData = meta
 }
 
 // finishUploadIfComplete checks whether an upload is completed (i.e. upload offset
@@ -686,14 +1308,32 @@ func (handler *UnroutedHandler) writeChunk(ctx context.Context, upload Upload, i
 func (handler *UnroutedHandler) finishUploadIfComplete(ctx context.Context, upload Upload, info FileInfo, r *http.Request) error {
 	// If the upload is completed, ...
 	if !info.SizeIsDeferred && info.Offset == info.Size {
+		// ... withhold it from downloads until it has been released
+		if handler.config.RequireRelease {
+			if err := handler.composer.Releaser.WithholdUpload(ctx, info.ID); err != nil {
+				handler.unfinished.add(info.ID)
+				return err
+			}
+		}
+
 		// ... allow custom mechanism to finish and cleanup the upload
 		if err := upload.FinishUpload(ctx); err != nil {
+			handler.unfinished.add(info.ID)
 			return err
 		}
 
+		// ... fetch the final state which may have been changed by the data store
+		if handler.config.NotifyCompleteUploads || handler.config.PreFinishResponseCallback != nil {
+			info = handler.finishedUploadInfo(ctx, upload, info)
+		}
+		// The upload's info may have been fetched before it was withheld
+		if handler.config.RequireRelease {
+			info.Unreleased = true
+		}
+
 		// ... send the info out to the channel
 		if handler.config.NotifyCompleteUploads {
-			handler.CompleteUploads <- newHookEvent(info, r)
+			handler.notifyCompleteUpload(newHookEvent(info, r))
 		}
 
 		handler.Metrics.incUploadsFinished()
@@ -708,10 +1348,37 @@ func (handler *UnroutedHandler) finishUploadIfComplete(ctx context.Context, uplo
 	return nil
 }
 
+// finishedUploadInfo retrieves the FileInfo of an upload after it has been
+// finished, so that changes made by the data store while finishing (e.g. to
+// the Storage map) are included in notifications. If the info cannot be
+// retrieved, the error is logged and the provided info is returned instead.
+func (handler *UnroutedHandler) finishedUploadInfo(ctx context.Context, upload Upload, info FileInfo) FileInfo {
+	finishedInfo, err := upload.GetInfo(ctx)
+	if err != nil {
+		handler.log("UploadInfoError", "id", info.ID, "error", err.Error())
+		return info
+	}
+
+	return finishedInfo
+}
+
+// notifyCompleteUpload sends the event on the CompleteUploads channel without
+// waiting for its consumer. If the channel's buffer is full, the event is
+// dropped and counted in Metrics.CompletionsDropped, so that a slow
+// consumer does not block uploads.
+func (handler *UnroutedHandler) notifyCompleteUpload(event HookEvent) {
+	select {
+	case handler.CompleteUploads <- event:
+	default:
+		handler.log("CompleteUploadDropped", "id", event.Upload.ID)
+		handler.Metrics.incCompletionsDropped()
+	}
+}
+
 // GetFile handles requests to download a file using a GET request. This is not
 // part of the specification.
 func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := newStoreContext(r)
 
 	id, err := extractIDFromPath(r.URL.Path)
 	if err != nil {
@@ -719,7 +1386,7 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if handler.composer.UsesLocker {
+	if handler.locksUploads() {
 		lock, err := handler.lockUpload(id)
 		if err != nil {
 			handler.sendError(w, r, err)
@@ -741,27 +1408,76 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Set headers before sending responses
-	w.Header().Set("Content-Length", strconv.FormatInt(info.Offset, 10))
+	if err := handler.authorizeRequest(info, r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	// Do not serve truncated content for uploads which are still in progress
+	if info.SizeIsDeferred || info.Offset != info.Size {
+		handler.sendError(w, r, ErrIncompleteUpload)
+		return
+	}
+
+	if handler.config.RequireRelease && info.Unreleased {
+		handler.sendError(w, r, handler.uploadUnreleasedError())
+		return
+	}
 
-	contentType, contentDisposition := filterContentType(info)
+	if handler.redirectDownload(ctx, w, r, upload, info) {
+		return
+	}
+
+	// Since finished uploads cannot be modified anymore, their ETag only
+	// needs to identify the upload and its size.
+	etag := uploadETag(info)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	contentType, contentDisposition := filterContentType(info, handler.downloadFiletype(info))
 	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Disposition", contentDisposition)
 
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		handler.sendResp(w, r, http.StatusNotModified)
+		return
+	}
+
 	// If no data has been uploaded yet, respond with an empty "204 No Content" status.
 	if info.Offset == 0 {
+		w.Header().Set("Content-Length", "0")
 		handler.sendResp(w, r, http.StatusNoContent)
 		return
 	}
 
+	start, length, isRange, err := parseRange(r.Header.Get("Range"), info.Offset)
+	if err != nil {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(info.Offset, 10))
+		handler.sendError(w, r, err)
+		return
+	}
+
 	src, err := upload.GetReader(ctx)
 	if err != nil {
 		handler.sendError(w, r, err)
 		return
 	}
 
-	handler.sendResp(w, r, http.StatusOK)
-	io.Copy(w, src)
+	if start > 0 {
+		if err := skipBytes(src, start); err != nil {
+			handler.sendError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if isRange {
+		w.Header().Set("Content-Range", "bytes "+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(start+length-1, 10)+"/"+strconv.FormatInt(info.Offset, 10))
+		handler.sendResp(w, r, http.StatusPartialContent)
+	} else {
+		handler.sendResp(w, r, http.StatusOK)
+	}
+	io.CopyN(w, src, length)
 
 	// Try to close the reader if the io.Closer interface is implemented
 	if closer, ok := src.(io.Closer); ok {
@@ -769,6 +1485,127 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// redirectDownload responds with a redirect to a signed URL for the upload's
+// content if the RedirectDownloads option is enabled, the upload is finished
+// and released, and its data store is able to sign URLs. It returns whether a
+// response has been sent.
+func (handler *UnroutedHandler) redirectDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, upload Upload, info FileInfo) bool {
+	if !handler.config.RedirectDownloads || info.SizeIsDeferred || info.Offset != info.Size {
+		return false
+	}
+
+	// Signed URLs cannot be revoked, so they must not exist before the release
+	if handler.config.RequireRelease && info.Unreleased {
+		return false
+	}
+
+	signableUpload, ok := upload.(SignableUpload)
+	if !ok {
+		return false
+	}
+
+	contentType, contentDisposition := filterContentType(info, handler.downloadFiletype(info))
+	url, err := signableUpload.SignURL(ctx, handler.config.DownloadURLExpiry, contentType, contentDisposition)
+	if err != nil {
+		handler.sendError(w, r, err)
+		return true
+	}
+
+	w.Header().Set("Location", url)
+	w.Header().Set("Cache-Control", "no-store")
+	handler.sendResp(w, r, http.StatusFound)
+	return true
+}
+
+// uploadETag returns the value of the ETag header for a finished upload.
+func uploadETag(info FileInfo) string {
+	return `"` + hex.EncodeToString([]byte(info.ID)) + "-" + strconv.FormatInt(info.Size, 16) + `"`
+}
+
+// etagMatches checks whether the value of an If-None-Match header matches the
+// given ETag. Weak comparison is used, as required by RFC 7232, Section 3.2.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRange interprets the value of a Range header for a resource of the
+// given size and returns the first byte and the number of bytes to serve. If
+// the header is absent, malformed or requests multiple ranges, the entire
+// resource is served, which RFC 7233 allows. ErrRangeNotSatisfiable is
+// returned if the requested range lies outside of the resource.
+func parseRange(header string, size int64) (start int64, length int64, isRange bool, err error) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, size, false, nil
+	}
+
+	spec := strings.TrimSpace(header[len("bytes="):])
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, size, false, nil
+	}
+
+	startStr, endStr := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if startStr == "" {
+		// Suffix range, e.g. bytes=-500 for the last 500 bytes
+		suffix, parseErr := strconv.ParseInt(endStr, 10, 64)
+		if parseErr != nil || suffix < 0 {
+			return 0, size, false, nil
+		}
+		if suffix == 0 {
+			return 0, 0, false, ErrRangeNotSatisfiable
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, nil
+	}
+
+	start, parseErr := strconv.ParseInt(startStr, 10, 64)
+	if parseErr != nil || start < 0 {
+		return 0, size, false, nil
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, parseErr = strconv.ParseInt(endStr, 10, 64)
+		if parseErr != nil || end < start {
+			return 0, size, false, nil
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return 0, 0, false, ErrRangeNotSatisfiable
+	}
+
+	return start, end - start + 1, true, nil
+}
+
+// skipBytes advances the reader by n bytes, either by seeking, if supported,
+// or by discarding the data.
+func skipBytes(src io.Reader, n int64) error {
+	if seeker, ok := src.(io.Seeker); ok {
+		_, err := seeker.Seek(n, io.SeekCurrent)
+		return err
+	}
+
+	_, err := io.CopyN(ioutil.Discard, src, n)
+	return err
+}
+
 // mimeInlineBrowserWhitelist is a map containing MIME types which should be
 // allowed to be rendered by browser inline, instead of being forced to be
 // downloadd. For example, HTML or SVG files are not allowed, since they may
@@ -799,12 +1636,10 @@ var mimeInlineBrowserWhitelist = map[string]struct{}{
 // filterContentType returns the values for the Content-Type and
 // Content-Disposition headers for a given upload. These values should be used
 // in responses for GET requests to ensure that only non-malicious file types
-// are shown directly in the browser. It will extract the file name and type
-// from the "fileame" and "filetype".
+// are shown directly in the browser. It will extract the file name from the
+// "filename" metadata, while the file type is passed in, see downloadFiletype.
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Disposition
-func filterContentType(info FileInfo) (contentType string, contentDisposition string) {
-	filetype := info.MetaData["filetype"]
-
+func filterContentType(info FileInfo, filetype string) (contentType string, contentDisposition string) {
 	if reMimeType.MatchString(filetype) {
 		// If the filetype from metadata is well formed, we forward use this
 		// for the Content-Type header. However, only whitelisted mime types
@@ -832,7 +1667,7 @@ func filterContentType(info FileInfo) (contentType string, contentDisposition st
 
 // DelFile terminates an upload permanently.
 func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := newStoreContext(r)
 
 	// Abort the request handling if the required interface is not implemented
 	if !handler.composer.UsesTerminater {
@@ -840,13 +1675,23 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Clients may not terminate uploads if it has been disabled, although the
+	// data store supports it for uploads removed by the server itself.
+	if handler.config.DisableTermination {
+		if handler.config.TerminationDisabledStatusCode == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", "POST, GET, HEAD, PATCH, OPTIONS")
+		}
+		handler.sendError(w, r, codedError{NewHTTPError(errTerminationDisabled, handler.config.TerminationDisabledStatusCode), "ERR_TERMINATION_DISABLED"})
+		return
+	}
+
 	id, err := extractIDFromPath(r.URL.Path)
 	if err != nil {
 		handler.sendError(w, r, err)
 		return
 	}
 
-	if handler.composer.UsesLocker {
+	if handler.locksUploads() {
 		lock, err := handler.lockUpload(id)
 		if err != nil {
 			handler.sendError(w, r, err)
@@ -863,7 +1708,7 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	var info FileInfo
-	if handler.config.NotifyTerminatedUploads {
+	if handler.config.NotifyTerminatedUploads || handler.config.AuthorizeRequestCallback != nil {
 		info, err = upload.GetInfo(ctx)
 		if err != nil {
 			handler.sendError(w, r, err)
@@ -871,21 +1716,28 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	err = handler.terminateUpload(ctx, upload, info, r)
+	if err := handler.authorizeRequest(info, r); err != nil {
+		handler.sendError(w, r, err)
+		return
+	}
+
+	err = handler.terminateUpload(ctx, upload, info, r, TerminationSourceClient)
 	if err != nil {
 		handler.sendError(w, r, err)
 		return
 	}
+	handler.unfinished.take(id)
 
 	handler.sendResp(w, r, http.StatusNoContent)
 }
 
 // terminateUpload passes a given upload to the DataStore's Terminater,
 // send the corresponding upload info on the TerminatedUploads channnel
-// and updates the statistics.
+// and updates the statistics. The notification is only sent once the data
+// store has successfully terminated the upload.
 // Note the the info argument is only needed if the terminated uploads
 // notifications are enabled.
-func (handler *UnroutedHandler) terminateUpload(ctx context.Context, upload Upload, info FileInfo, r *http.Request) error {
+func (handler *UnroutedHandler) terminateUpload(ctx context.Context, upload Upload, info FileInfo, r *http.Request, source TerminationSource) error {
 	terminatableUpload := handler.composer.Terminater.AsTerminatableUpload(upload)
 
 	err := terminatableUpload.Terminate(ctx)
@@ -894,7 +1746,9 @@ func (handler *UnroutedHandler) terminateUpload(ctx context.Context, upload Uplo
 	}
 
 	if handler.config.NotifyTerminatedUploads {
-		handler.TerminatedUploads <- newHookEvent(info, r)
+		event := newHookEvent(info, r)
+		event.TerminationSource = source
+		handler.TerminatedUploads <- event
 	}
 
 	handler.Metrics.incUploadsTerminated()
@@ -944,12 +1798,38 @@ func (handler *UnroutedHandler) sendError(w http.ResponseWriter, r *http.Request
 		statusErr = NewHTTPError(err, http.StatusInternalServerError)
 	}
 
+	contentType := "text/plain; charset=utf-8"
 	reason := append(statusErr.Body(), '\n')
+	if handler.config.JSONErrors {
+		contentType = "application/json; charset=utf-8"
+		reason = jsonErrorBody(err, statusErr)
+	}
 	if r.Method == "HEAD" {
 		reason = nil
 	}
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// Tell the client when it may retry if another request is currently
+	// holding the lock for this upload. Held and unreleased uploads may share
+	// the status code but are told apart by their error code.
+	code := errorCode(err, statusErr.StatusCode())
+	isLocked := statusErr.StatusCode() == ErrFileLocked.StatusCode() && code != errCodeUploadOnHold && code != errCodeUploadUnreleased
+	if isLocked || err == ErrUploadBusy {
+		seconds := int64(math.Ceil(handler.config.LockedRetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+
+	var limited rateLimitedError
+	if errors.As(err, &limited) {
+		seconds := int64(math.Ceil(limited.retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+
+	// Recorders may be nested, e.g. by PatchFile within the Middleware
+	for recorder, ok := w.(*statusRecorder); ok; recorder, ok = recorder.ResponseWriter.(*statusRecorder) {
+		recorder.errorCode = code
+	}
+
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", strconv.Itoa(len(reason)))
 	w.WriteHeader(statusErr.StatusCode())
 	w.Write(reason)
@@ -1054,9 +1934,14 @@ func getHostAndProtocol(r *http.Request, allowForwarded bool) (host, proto strin
 // The get sum of all sizes for a list of upload ids while checking whether
 // all of these uploads are finished yet. This is used to calculate the size
 // of a final resource.
-func (handler *UnroutedHandler) sizeOfUploads(ctx context.Context, ids []string) (partialUploads []Upload, size int64, err error) {
+func (handler *UnroutedHandler) sizeOfUploads(ctx context.Context, r *http.Request, ids []string) (partialUploads []Upload, size int64, err error) {
 	partialUploads = make([]Upload, len(ids))
 
+	// The content of the partial uploads becomes readable through the final
+	// upload, so the client must be allowed to download each of them.
+	readRequest := r.Clone(r.Context())
+	readRequest.Method = "GET"
+
 	for i, id := range ids {
 		upload, err := handler.composer.Core.GetUpload(ctx, id)
 		if err != nil {
@@ -1068,6 +1953,10 @@ func (handler *UnroutedHandler) sizeOfUploads(ctx context.Context, ids []string)
 			return nil, 0, err
 		}
 
+		if err := handler.authorizeRequest(info, readRequest); err != nil {
+			return nil, 0, err
+		}
+
 		if info.SizeIsDeferred || info.Offset != info.Size {
 			err = ErrUploadNotFinished
 			return nil, 0, err
@@ -1105,19 +1994,255 @@ func (handler *UnroutedHandler) validateNewUploadLengthHeaders(uploadLengthHeade
 	return
 }
 
+// authorizeRequest invokes the AuthorizeRequestCallback, if configured, for a
+// request concerning the existing upload described by info.
+func (handler *UnroutedHandler) authorizeRequest(info FileInfo, r *http.Request) error {
+	if handler.config.AuthorizeRequestCallback == nil {
+		return nil
+	}
+
+	_, err := handler.config.AuthorizeRequestCallback(newHookEvent(info, r))
+	return err
+}
+
+// locksUploads checks whether requests must lock the upload they concern,
+// either by a registered locker or by waiting in the queue.
+func (handler *UnroutedHandler) locksUploads() bool {
+	return handler.composer.UsesLocker || handler.config.UploadQueueTimeout > 0
+}
+
 // lockUpload creates a new lock for the given upload ID and attempts to lock it.
-// The created lock is returned if it was aquired successfully.
+// The created lock is returned if it was aquired successfully. If the
+// UploadQueueTimeout option is set, the request first waits for previous
+// requests to the same upload in this process, before the registered locker,
+// if any, is used for excluding requests handled by other instances.
 func (handler *UnroutedHandler) lockUpload(id string) (Lock, error) {
-	lock, err := handler.composer.Locker.NewLock(id)
+	release := func() {}
+	if timeout := handler.config.UploadQueueTimeout; timeout > 0 {
+		handler.Metrics.incRequestsQueued()
+		start := time.Now()
+		var ok bool
+		release, ok = handler.queue.acquire(id, timeout)
+		handler.Metrics.decRequestsQueued(time.Since(start))
+		if !ok {
+			handler.log("UploadQueueTimeout", "id", id)
+			return nil, ErrUploadBusy
+		}
+	}
+
+	var lock Lock
+	if handler.composer.UsesLocker {
+		var err error
+		lock, err = handler.composer.Locker.NewLock(id)
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		if err := lock.Lock(); err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return queuedLock{lock, release}, nil
+}
+
+// queuedLock combines the lock from the registered locker, if any, with the
+// slot in the upload queue.
+type queuedLock struct {
+	lock    Lock
+	release func()
+}
+
+// Lock is not used since queuedLock is only returned after it has been locked.
+func (l queuedLock) Lock() error {
+	return nil
+}
+
+func (l queuedLock) Unlock() error {
+	var err error
+	if l.lock != nil {
+		err = l.lock.Unlock()
+	}
+	l.release()
+	return err
+}
+
+// parseMetadata parses the Upload-Metadata header of a creation request and
+// validates it according to the configured metadata options. Reserved keys are
+// removed from the metadata, so that only the server can set them.
+func (handler *UnroutedHandler) parseMetadata(header string) (MetaData, error) {
+	var meta MetaData
+	if handler.config.StrictMetadata {
+		var err error
+		meta, err = parseMetadataHeaderStrict(header)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		meta = ParseMetadataHeader(header)
+	}
+
+	for _, key := range handler.config.ReservedMetadataKeys {
+		delete(meta, key)
+	}
+	if key := handler.config.CreationRateLimitOwnerKey; key != "" {
+		delete(meta, key)
+	}
+	if handler.config.DetectFiletype {
+		delete(meta, DetectedFiletypeKey)
+	}
+
+	for key, value := range meta {
+		if len(handler.config.AllowedMetadataKeys) > 0 && !containsString(handler.config.AllowedMetadataKeys, key) {
+			return nil, codedError{NewHTTPError(fmt.Errorf("metadata key %q is not allowed", key), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+		}
+
+		if containsString(handler.config.DeniedMetadataKeys, key) {
+			return nil, codedError{NewHTTPError(fmt.Errorf("metadata key %q is not allowed", key), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+		}
+
+		if validate, ok := handler.config.MetadataValidators[key]; ok {
+			if err := validate(value); err != nil {
+				return nil, codedError{NewHTTPError(fmt.Errorf("invalid value for metadata key %q: %s", key, err), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+// recordRequestMetadata adds the request attributes, which should be recorded
+// for new uploads, to the metadata. Values supplied by the client for the same
+// keys are overwritten, or removed if the request lacks the header to record.
+func (handler *UnroutedHandler) recordRequestMetadata(meta MetaData, r *http.Request) {
+	if key := handler.config.ClientIPMetadataKey; key != "" {
+		meta[key] = handler.clientIP(r)
+	}
+
+	if key := handler.config.UserAgentMetadataKey; key != "" {
+		recordHeader(meta, key, r.UserAgent())
+	}
+
+	for header, key := range handler.config.HeaderMetadataKeys {
+		recordHeader(meta, key, r.Header.Get(header))
+	}
+}
+
+// recordHeader records the header's value under the key, unless the header is
+// missing.
+func recordHeader(meta MetaData, key, value string) {
+	if value == "" {
+		delete(meta, key)
+		return
+	}
+	meta[key] = value
+}
+
+// clientIP returns the IP address of the client which sent the request. If the
+// request reached us through trusted proxies, the X-Forwarded-For header is
+// walked from the nearest proxy backwards until the first untrusted address,
+// which is the client's one. Entries further left may be forged by the client.
+func (handler *UnroutedHandler) clientIP(r *http.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return nil, err
+		addr = r.RemoteAddr
 	}
 
-	if err := lock.Lock(); err != nil {
-		return nil, err
+	if !handler.isTrustedProxy(addr) {
+		return addr
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			// A malformed entry cannot be trusted, so we stop at the last
+			// proxy which added a valid one.
+			break
+		}
+
+		addr = hop
+		if !handler.isTrustedProxy(addr) {
+			break
+		}
+	}
+
+	return addr
+}
+
+// isTrustedProxy checks whether the address belongs to one of the trusted
+// proxies.
+func (handler *UnroutedHandler) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range handler.config.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
 	}
 
-	return lock, nil
+	return false
+}
+
+// parseMetadataHeaderStrict parses the Upload-Metadata header in the same way
+// as ParseMetadataHeader but returns an error for malformed elements instead
+// of ignoring them.
+func parseMetadataHeaderStrict(header string) (MetaData, error) {
+	meta := make(MetaData)
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+
+	for _, element := range strings.Split(header, ",") {
+		element := strings.TrimSpace(element)
+
+		parts := strings.Split(element, " ")
+		key := parts[0]
+		if key == "" {
+			return nil, codedError{NewHTTPError(errors.New("invalid Upload-Metadata header: empty key"), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+		}
+
+		if len(parts) > 2 {
+			return nil, codedError{NewHTTPError(fmt.Errorf("invalid Upload-Metadata header: malformed value for key %q", key), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+		}
+
+		if _, ok := meta[key]; ok {
+			return nil, codedError{NewHTTPError(fmt.Errorf("invalid Upload-Metadata header: duplicate key %q", key), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+		}
+
+		value := ""
+		if len(parts) == 2 {
+			dec, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, codedError{NewHTTPError(fmt.Errorf("invalid Upload-Metadata header: value for key %q is not valid base64", key), http.StatusBadRequest), "ERR_INVALID_METADATA"}
+			}
+
+			value = string(dec)
+		}
+
+		meta[key] = value
+	}
+
+	return meta, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
 }
 
 // ParseMetadataHeader parses the Upload-Metadata header as defined in the
@@ -1231,19 +2356,13 @@ func i64toa(num int64) string {
 	return strconv.FormatInt(num, 10)
 }
 
-// getRequestId returns the value of the X-Request-ID header, if available,
-// and also takes care of truncating the input.
+// getRequestId returns the request's ID as attached to its context by the
+// middleware or, if not available, the value of the X-Request-ID header. It
+// also takes care of truncating the input.
 func getRequestId(r *http.Request) string {
-	reqId := r.Header.Get("X-Request-ID")
-	if reqId == "" {
-		return ""
-	}
-
-	// Limit the length of the request ID to 36 characters, which is enough
-	// to fit a UUID.
-	if len(reqId) > 36 {
-		reqId = reqId[:36]
+	if reqId, ok := RequestIDFromContext(r.Context()); ok {
+		return reqId
 	}
 
-	return reqId
+	return truncateRequestID(r.Header.Get("X-Request-ID"))
 }
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// uploadQueue serializes the requests concerning the same upload within this
+// process. In contrast to a Locker, which rejects a request if the upload is
+// already locked, the queue lets the request wait until the previous one has
+// finished. It does not provide any safety across multiple instances, for
+// which a Locker is still required.
+type uploadQueue struct {
+	mutex   sync.Mutex
+	entries map[string]*uploadQueueEntry
+}
+
+type uploadQueueEntry struct {
+	// slot is a channel with a capacity of one, which is filled while a request
+	// is being handled for the upload.
+	slot chan struct{}
+	// refs is the number of requests which either hold or wait for the slot.
+	refs int
+}
+
+func newUploadQueue() *uploadQueue {
+	return &uploadQueue{
+		entries: make(map[string]*uploadQueueEntry),
+	}
+}
+
+// acquire waits until no other request is handled for the upload or the
+// timeout has passed. If the slot could be acquired, a function for releasing
+// it is returned. Otherwise, ok is false.
+func (q *uploadQueue) acquire(id string, timeout time.Duration) (release func(), ok bool) {
+	q.mutex.Lock()
+	entry, exists := q.entries[id]
+	if !exists {
+		entry = &uploadQueueEntry{
+			slot: make(chan struct{}, 1),
+		}
+		q.entries[id] = entry
+	}
+	entry.refs++
+	q.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case entry.slot <- struct{}{}:
+		return func() {
+			<-entry.slot
+			q.unref(id, entry)
+		}, true
+	case <-timer.C:
+		q.unref(id, entry)
+		return nil, false
+	}
+}
+
+// unref removes the entry for an upload once no request holds or waits for
+// it anymore.
+func (q *uploadQueue) unref(id string, entry *uploadQueueEntry) {
+	q.mutex.Lock()
+	entry.refs--
+	if entry.refs == 0 {
+		delete(q.entries, id)
+	}
+	q.mutex.Unlock()
+}
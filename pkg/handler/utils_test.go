@@ -26,6 +26,12 @@ type FullDataStore interface {
 	handler.TerminaterDataStore
 	handler.ConcaterDataStore
 	handler.LengthDeferrerDataStore
+	handler.ExpirerDataStore
+	handler.TruncaterDataStore
+	handler.HolderDataStore
+	handler.ListerDataStore
+	handler.MetaDataUpdaterDataStore
+	handler.ReleaserDataStore
 }
 
 type FullUpload interface {
@@ -33,6 +39,10 @@ type FullUpload interface {
 	handler.TerminatableUpload
 	handler.LengthDeclarableUpload
 	handler.ConcatableUpload
+	handler.ExpirableUpload
+	handler.TruncatableUpload
+	handler.HoldableUpload
+	handler.MetaDataUpdatableUpload
 }
 
 type FullLocker interface {
@@ -89,6 +99,15 @@ func (test *httpTest) Run(handler http.Handler, t *testing.T) *httptest.Response
 	return w
 }
 
+// fromAddr lets the requests originate from the given address instead of the
+// one shared by all test requests.
+func fromAddr(handler http.Handler, addr string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = addr + ":1234"
+		handler.ServeHTTP(w, r)
+	})
+}
+
 type readerMatcher struct {
 	expect string
 }
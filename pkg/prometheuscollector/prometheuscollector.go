@@ -11,6 +11,7 @@ package prometheuscollector
 import (
 	"strconv"
 	"sync/atomic"
+	"time"
 
 	"github.com/tus/tusd/pkg/handler"
 
@@ -42,6 +43,38 @@ var (
 		"tusd_uploads_terminated",
 		"Number of terminated uploads.",
 		nil, nil)
+	requestDurationDesc = prometheus.NewDesc(
+		"tusd_request_duration_seconds",
+		"Number of handled requests and the time spent on them per method, status, outcome and store.",
+		[]string{"method", "status", "outcome", "store"}, nil)
+	chunkWritesInProgressDesc = prometheus.NewDesc(
+		"tusd_chunk_writes_in_progress",
+		"Number of requests whose body is currently being written to the data store.",
+		nil, nil)
+	requestsQueuedDesc = prometheus.NewDesc(
+		"tusd_requests_queued",
+		"Number of requests currently waiting for previous requests to the same upload.",
+		nil, nil)
+	queueWaitDesc = prometheus.NewDesc(
+		"tusd_queue_wait_seconds",
+		"Number of requests which have waited for previous requests to the same upload and the time spent waiting.",
+		nil, nil)
+	patchChunkSizeDesc = prometheus.NewDesc(
+		"tusd_patch_chunk_size_bytes",
+		"Number of bytes written to the data store per PATCH request and outcome.",
+		[]string{"outcome"}, nil)
+	patchDurationDesc = prometheus.NewDesc(
+		"tusd_patch_duration_seconds",
+		"Time spent on PATCH requests per outcome.",
+		[]string{"outcome"}, nil)
+	chunksCutOffDesc = prometheus.NewDesc(
+		"tusd_chunks_cut_off",
+		"Number of PATCH requests whose body has been cut off at the maximum chunk size.",
+		nil, nil)
+	completeUploadsDroppedDesc = prometheus.NewDesc(
+		"tusd_complete_uploads_dropped",
+		"Number of completion events dropped because their consumer fell behind.",
+		nil, nil)
 )
 
 type Collector struct {
@@ -62,6 +95,14 @@ func (_ Collector) Describe(descs chan<- *prometheus.Desc) {
 	descs <- uploadsCreatedDesc
 	descs <- uploadsFinishedDesc
 	descs <- uploadsTerminatedDesc
+	descs <- requestDurationDesc
+	descs <- chunkWritesInProgressDesc
+	descs <- requestsQueuedDesc
+	descs <- queueWaitDesc
+	descs <- patchChunkSizeDesc
+	descs <- patchDurationDesc
+	descs <- chunksCutOffDesc
+	descs <- completeUploadsDroppedDesc
 }
 
 func (c Collector) Collect(metrics chan<- prometheus.Metric) {
@@ -107,4 +148,68 @@ func (c Collector) Collect(metrics chan<- prometheus.Metric) {
 		prometheus.CounterValue,
 		float64(atomic.LoadUint64(c.metrics.UploadsTerminated)),
 	)
+
+	for req, stats := range c.metrics.RequestsHandled.Load() {
+		metrics <- prometheus.MustNewConstSummary(
+			requestDurationDesc,
+			stats.Count,
+			stats.Duration.Seconds(),
+			nil,
+			req.Method,
+			strconv.Itoa(req.StatusCode),
+			req.Outcome,
+			req.Store,
+		)
+	}
+
+	metrics <- prometheus.MustNewConstMetric(
+		chunkWritesInProgressDesc,
+		prometheus.GaugeValue,
+		float64(atomic.LoadInt64(c.metrics.ChunkWritesInProgress)),
+	)
+
+	metrics <- prometheus.MustNewConstMetric(
+		requestsQueuedDesc,
+		prometheus.GaugeValue,
+		float64(atomic.LoadInt64(c.metrics.RequestsQueued)),
+	)
+
+	metrics <- prometheus.MustNewConstSummary(
+		queueWaitDesc,
+		atomic.LoadUint64(c.metrics.QueueWaits),
+		time.Duration(atomic.LoadInt64(c.metrics.QueueWaitDuration)).Seconds(),
+		nil,
+	)
+
+	for outcome, stats := range c.metrics.PatchChunkSizes.Load() {
+		metrics <- prometheus.MustNewConstHistogram(
+			patchChunkSizeDesc,
+			stats.Count,
+			stats.Sum,
+			stats.Buckets,
+			outcome,
+		)
+	}
+
+	for outcome, stats := range c.metrics.PatchDurations.Load() {
+		metrics <- prometheus.MustNewConstHistogram(
+			patchDurationDesc,
+			stats.Count,
+			stats.Sum,
+			stats.Buckets,
+			outcome,
+		)
+	}
+
+	metrics <- prometheus.MustNewConstMetric(
+		chunksCutOffDesc,
+		prometheus.CounterValue,
+		float64(atomic.LoadUint64(c.metrics.ChunksCutOff)),
+	)
+
+	metrics <- prometheus.MustNewConstMetric(
+		completeUploadsDroppedDesc,
+		prometheus.CounterValue,
+		float64(atomic.LoadUint64(c.metrics.CompletionsDropped)),
+	)
 }
@@ -0,0 +1,101 @@
+package prometheuscollector
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	"github.com/tus/tusd/pkg/handler"
+)
+
+// unsizedReader hides the length of the wrapped reader, so that the request
+// body is sent without Content-Length.
+type unsizedReader struct {
+	io.Reader
+}
+
+func TestPatchMetrics(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "tusd-prometheuscollector-test")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	composer := handler.NewStoreComposer()
+	filestore.New(dir).UseIn(composer)
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		StoreComposer:        composer,
+		BasePath:             "/files/",
+		MaxChunkSize:         4,
+		ChunkSizeBuckets:     []float64{1, 2, 4, 8},
+		PatchDurationBuckets: []float64{60},
+	})
+	a.NoError(err)
+
+	server := httptest.NewServer(http.StripPrefix("/files/", tusHandler))
+	defer server.Close()
+
+	do := func(method string, url string, body io.Reader, headers ...string) *http.Response {
+		req, _ := http.NewRequest(method, url, body)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		return res
+	}
+
+	patch := func(url string, offset string, body io.Reader, code int) {
+		res := do("PATCH", url, body, "Content-Type", "application/offset+octet-stream", "Upload-Offset", offset)
+		a.Equal(code, res.StatusCode)
+	}
+
+	res := do("POST", server.URL+"/files/", nil, "Upload-Length", "14")
+	a.Equal(http.StatusCreated, res.StatusCode)
+	url := res.Header.Get("Location")
+
+	// Bodies are cut off at the maximum chunk size with and without
+	// Content-Length, except for those ending at the limit
+	patch(url, "0", strings.NewReader("hellowor"), http.StatusNoContent)
+	patch(url, "4", unsizedReader{strings.NewReader("oworld")}, http.StatusNoContent)
+	patch(url, "8", unsizedReader{strings.NewReader("ld!!")}, http.StatusNoContent)
+	patch(url, "0", strings.NewReader("hell"), http.StatusConflict)
+	patch(url, "12", strings.NewReader("!!"), http.StatusNoContent)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(New(tusHandler.Metrics))
+	scrape := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(scrape, httptest.NewRequest("GET", "/metrics", nil))
+	body := scrape.Body.String()
+
+	for _, line := range []string{
+		`tusd_patch_chunk_size_bytes_bucket{outcome="accepted",le="2"} 0`,
+		`tusd_patch_chunk_size_bytes_bucket{outcome="accepted",le="4"} 3`,
+		`tusd_patch_chunk_size_bytes_bucket{outcome="accepted",le="+Inf"} 3`,
+		`tusd_patch_chunk_size_bytes_sum{outcome="accepted"} 12`,
+		`tusd_patch_chunk_size_bytes_bucket{outcome="completed",le="1"} 0`,
+		`tusd_patch_chunk_size_bytes_bucket{outcome="completed",le="2"} 1`,
+		`tusd_patch_chunk_size_bytes_bucket{outcome="rejected",le="1"} 1`,
+		`tusd_patch_chunk_size_bytes_count{outcome="rejected"} 1`,
+		`tusd_patch_duration_seconds_bucket{outcome="accepted",le="60"} 3`,
+		`tusd_patch_duration_seconds_bucket{outcome="completed",le="60"} 1`,
+		`tusd_patch_duration_seconds_count{outcome="rejected"} 1`,
+		`tusd_chunks_cut_off 2`,
+		`tusd_request_duration_seconds_count{method="PATCH",outcome="success",status="204",store="filestore"} 4`,
+		`tusd_request_duration_seconds_count{method="PATCH",outcome="ERR_OFFSET_MISMATCH",status="409",store="filestore"} 1`,
+	} {
+		a.Contains(body, line+"\n")
+	}
+	a.NotContains(body, `outcome="failed"`)
+}
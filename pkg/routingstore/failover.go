@@ -0,0 +1,218 @@
+package routingstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/tus/tusd/pkg/handler"
+)
+
+const (
+	// MigrateToKey is the metadata key under which uploads created by a fallback
+	// record the name of the route they are migrated to once they are finished.
+	MigrateToKey = "routingstore-migrate-to"
+	// MigratedToKey is the metadata key under which migrated uploads record the
+	// ID of their copy. Requests for the upload are then served by the copy.
+	MigratedToKey = "routingstore-migrated-to"
+)
+
+// migrationPageSize is the number of uploads listed at once while looking for
+// uploads to migrate.
+const migrationPageSize = 100
+
+// IsUnavailable reports whether the error returned by a data store indicates
+// that the data store or its backend cannot be reached, in contrast to errors
+// caused by the request itself, such as validation errors. Network errors,
+// timeouts and errors carrying a 5xx or 429 HTTP status code, as returned by
+// the SDKs of cloud storages, are considered as such.
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var statusErr interface {
+		StatusCode() int
+	}
+	if errors.As(err, &statusErr) {
+		code := statusErr.StatusCode()
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Migrate copies the uploads which have been created by a fallback back to the
+// route they were matched by. Only finished uploads are migrated, which are
+// neither partial, on hold nor unreleased. After the copy has been finished,
+// its ID is recorded in the upload's metadata, so that requests for the
+// upload's ID are served by the copy, including its storage details. The data
+// in the fallback is then removed if its data store supports truncating
+// uploads, while its record remains. Terminating the migrated upload removes
+// the copy. The migration of the remaining uploads continues if an upload
+// cannot be migrated. The number of migrated uploads and the first error are
+// returned.
+func (store RoutingStore) Migrate(ctx context.Context) (int, error) {
+	migrated := 0
+	var firstErr error
+
+	for _, route := range store.routes {
+		if !store.fallbacks[route.Name] {
+			continue
+		}
+
+		after := ""
+		for {
+			infos, err := route.Composer.Lister.ListUploads(ctx, after, migrationPageSize)
+			if err != nil {
+				return migrated, err
+			}
+
+			for _, info := range infos {
+				if !needsMigration(info) {
+					continue
+				}
+
+				if err := store.migrateUpload(ctx, route, info); err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("routingstore: failed to migrate upload %s: %w", route.Name+separator+info.ID, err)
+					}
+					continue
+				}
+				migrated++
+			}
+
+			if len(infos) < migrationPageSize {
+				break
+			}
+			after = infos[len(infos)-1].ID
+		}
+	}
+
+	return migrated, firstErr
+}
+
+// RunMigrator invokes Migrate in the given interval until the context is
+// cancelled. Errors are passed to onError, which may be nil.
+func (store RoutingStore) RunMigrator(ctx context.Context, interval time.Duration, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.Migrate(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// needsMigration checks whether the upload has been created by a fallback and
+// is ready to be migrated.
+func needsMigration(info handler.FileInfo) bool {
+	if _, ok := info.MetaData[MigrateToKey]; !ok {
+		return false
+	}
+	if _, ok := info.MetaData[MigratedToKey]; ok {
+		return false
+	}
+
+	finished := !info.SizeIsDeferred && info.Offset == info.Size
+	return finished && !info.IsPartial && !info.OnHold && !info.Unreleased
+}
+
+// migrateUpload copies the upload from the fallback route to the route it was
+// matched by and records the copy's ID.
+func (store RoutingStore) migrateUpload(ctx context.Context, fallback *Route, info handler.FileInfo) error {
+	target, ok := store.byName[info.MetaData[MigrateToKey]]
+	if !ok {
+		return fmt.Errorf("unknown route %q", info.MetaData[MigrateToKey])
+	}
+
+	upload, err := fallback.Composer.Core.GetUpload(ctx, info.ID)
+	if err != nil {
+		return err
+	}
+
+	meta := make(handler.MetaData, len(info.MetaData))
+	for key, value := range info.MetaData {
+		if key != MigrateToKey {
+			meta[key] = value
+		}
+	}
+
+	copiedUpload, err := target.Composer.Core.NewUpload(ctx, handler.FileInfo{
+		Size:     info.Size,
+		MetaData: meta,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := copyUpload(ctx, upload, copiedUpload, info.Size); err != nil {
+		// Do not leave an incomplete copy behind, it is created anew next time
+		if target.Composer.UsesTerminater {
+			target.Composer.Terminater.AsTerminatableUpload(copiedUpload).Terminate(ctx)
+		}
+		return err
+	}
+
+	copiedInfo, err := copiedUpload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Recording the copy's ID makes it visible to clients
+	meta = make(handler.MetaData, len(info.MetaData)+1)
+	for key, value := range info.MetaData {
+		meta[key] = value
+	}
+	meta[MigratedToKey] = target.Name + separator + copiedInfo.ID
+	if err := fallback.Composer.MetaDataUpdater.AsMetaDataUpdatableUpload(upload).SetMetaData(ctx, meta); err != nil {
+		return err
+	}
+
+	if fallback.Composer.UsesTruncater {
+		return fallback.Composer.Truncater.AsTruncatableUpload(upload).Truncate(ctx, 0)
+	}
+
+	return nil
+}
+
+// copyUpload writes the content of the source upload into the destination and
+// finishes it.
+func copyUpload(ctx context.Context, src handler.Upload, dst handler.Upload, size int64) error {
+	reader, err := src.GetReader(ctx)
+	if err != nil {
+		return err
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	written, err := dst.WriteChunk(ctx, 0, reader)
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("copied %d of %d bytes", written, size)
+	}
+
+	return dst.FinishUpload(ctx)
+}
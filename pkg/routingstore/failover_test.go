@@ -0,0 +1,249 @@
+package routingstore
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	"github.com/tus/tusd/pkg/handler"
+)
+
+// statusError imitates the errors of cloud storage SDKs.
+type statusError int
+
+func (err statusError) Error() string {
+	return fmt.Sprintf("request failed with status %d", int(err))
+}
+
+func (err statusError) StatusCode() int {
+	return int(err)
+}
+
+// flakyStore is a data store whose creation of uploads fails with err, if set.
+type flakyStore struct {
+	handler.DataStore
+	err *error
+}
+
+func (store flakyStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if *store.err != nil {
+		return nil, *store.err
+	}
+	return store.DataStore.NewUpload(ctx, info)
+}
+
+func TestIsUnavailable(t *testing.T) {
+	a := assert.New(t)
+
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	for _, err := range []error{
+		dialErr,
+		fmt.Errorf("s3store: %w", dialErr),
+		context.DeadlineExceeded,
+		syscall.ECONNRESET,
+		statusError(http.StatusServiceUnavailable),
+		statusError(http.StatusTooManyRequests),
+		handler.NewHTTPError(errors.New("bad gateway"), http.StatusBadGateway),
+	} {
+		a.True(IsUnavailable(err), err.Error())
+	}
+
+	for _, err := range []error{
+		nil,
+		context.Canceled,
+		handler.ErrMaxSizeExceeded,
+		statusError(http.StatusForbidden),
+		errors.New("upload directory does not exist"),
+	} {
+		a.False(IsUnavailable(err), fmt.Sprint(err))
+	}
+}
+
+func TestFailover(t *testing.T) {
+	a := assert.New(t)
+
+	ossDir, err := ioutil.TempDir("", "tusd-routingstore-oss-")
+	a.NoError(err)
+	defer os.RemoveAll(ossDir)
+	localDir, err := ioutil.TempDir("", "tusd-routingstore-local-")
+	a.NoError(err)
+	defer os.RemoveAll(localDir)
+
+	var primaryErr error
+	oss := handler.NewStoreComposer()
+	filestore.New(ossDir).UseIn(oss)
+	oss.UseCore(flakyStore{DataStore: oss.Core, err: &primaryErr})
+	local := handler.NewStoreComposer()
+	filestore.New(localDir).UseIn(local)
+
+	store, err := New([]Route{
+		{Name: "oss", Composer: oss, Fallback: "local"},
+		{Name: "local", Composer: local, Match: func(handler.FileInfo) bool { return false }},
+	})
+	a.NoError(err)
+
+	composer := handler.NewStoreComposer()
+	store.UseIn(composer)
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		StoreComposer: composer,
+		BasePath:      "/files/",
+	})
+	a.NoError(err)
+
+	server := httptest.NewServer(http.StripPrefix("/files/", tusHandler))
+	defer server.Close()
+
+	do := func(method string, url string, body string, headers ...string) *http.Response {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		return res
+	}
+
+	create := func() *http.Response {
+		res := do("POST", server.URL+"/files/", "", "Upload-Length", "10", "Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("a.txt")))
+		res.Body.Close()
+		return res
+	}
+
+	patch := func(url string, offset string, body string) {
+		res := do("PATCH", url, body, "Content-Type", "application/offset+octet-stream", "Upload-Offset", offset)
+		res.Body.Close()
+		a.Equal(http.StatusNoContent, res.StatusCode)
+	}
+
+	// Validation errors are not hidden by the fallback
+	primaryErr = statusError(http.StatusBadRequest)
+	res := create()
+	a.Equal(http.StatusInternalServerError, res.StatusCode)
+
+	primaryErr = &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	res = create()
+	a.Equal(http.StatusCreated, res.StatusCode)
+	url := res.Header.Get("Location")
+	id := strings.TrimPrefix(url, server.URL+"/files/")
+	a.True(strings.HasPrefix(id, "local-"), id)
+
+	// The upload stays on the fallback once the primary is available again
+	primaryErr = nil
+	patch(url, "0", "hello")
+	res = create()
+	a.True(strings.HasPrefix(res.Header.Get("Location"), server.URL+"/files/oss-"))
+
+	migrated, err := store.Migrate(context.Background())
+	a.NoError(err)
+	a.Equal(0, migrated)
+
+	patch(url, "5", "world")
+	migrated, err = store.Migrate(context.Background())
+	a.NoError(err)
+	a.Equal(1, migrated)
+	migrated, err = store.Migrate(context.Background())
+	a.NoError(err)
+	a.Equal(0, migrated)
+
+	// The upload is served by the copy under its original ID
+	upload, err := store.GetUpload(context.Background(), id)
+	a.NoError(err)
+	info, err := upload.GetInfo(context.Background())
+	a.NoError(err)
+	a.Equal(id, info.ID)
+	a.EqualValues(10, info.Offset)
+	a.Equal(handler.MetaData{"filename": "a.txt"}, info.MetaData)
+	a.True(strings.HasPrefix(info.Storage["Path"], ossDir))
+
+	res = do("HEAD", url, "")
+	res.Body.Close()
+	a.Equal(http.StatusOK, res.StatusCode)
+	a.Equal("10", res.Header.Get("Upload-Offset"))
+	a.Equal("filename "+base64.StdEncoding.EncodeToString([]byte("a.txt")), res.Header.Get("Upload-Metadata"))
+
+	res, err = http.Get(url)
+	a.NoError(err)
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	a.NoError(err)
+	a.Equal("helloworld", string(content))
+
+	// The data on the fallback has been removed
+	stat, err := os.Stat(filepath.Join(localDir, strings.TrimPrefix(id, "local-")))
+	a.NoError(err)
+	a.EqualValues(0, stat.Size())
+
+	// Only the copy is listed
+	infos, err := store.ListUploads(context.Background(), "", 10)
+	a.NoError(err)
+	a.Len(infos, 2)
+	for _, info := range infos {
+		a.True(strings.HasPrefix(info.ID, "oss-"), info.ID)
+	}
+
+	// Terminating the upload removes the copy
+	res = do("DELETE", url, "")
+	res.Body.Close()
+	a.Equal(http.StatusNoContent, res.StatusCode)
+	res = do("HEAD", url, "")
+	res.Body.Close()
+	a.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func TestFailoverForgedMetaData(t *testing.T) {
+	a := assert.New(t)
+
+	store, smallDir, largeDir := setup(t)
+	defer os.RemoveAll(smallDir)
+	defer os.RemoveAll(largeDir)
+
+	ctx := context.Background()
+	victim, err := store.NewUpload(ctx, handler.FileInfo{Size: 5})
+	a.NoError(err)
+	victimInfo, err := victim.GetInfo(ctx)
+	a.NoError(err)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 5,
+		MetaData: handler.MetaData{
+			MigrateToKey:  "large",
+			MigratedToKey: victimInfo.ID,
+		},
+	})
+	a.NoError(err)
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Empty(info.MetaData)
+}
+
+func TestNewFallback(t *testing.T) {
+	a := assert.New(t)
+
+	full := handler.NewStoreComposer()
+	filestore.New(".").UseIn(full)
+	core := handler.NewStoreComposer()
+	core.UseCore(filestore.New("."))
+
+	_, err := New([]Route{{Name: "a", Composer: full, Fallback: "b"}})
+	a.EqualError(err, `routingstore: invalid fallback "b" for route "a"`)
+
+	_, err = New([]Route{{Name: "a", Composer: full, Fallback: "a"}})
+	a.EqualError(err, `routingstore: invalid fallback "a" for route "a"`)
+
+	_, err = New([]Route{{Name: "a", Composer: full, Fallback: "b"}, {Name: "b", Composer: core}})
+	a.EqualError(err, `routingstore: data store of fallback "b" cannot list uploads and update metadata`)
+}
@@ -0,0 +1,496 @@
+// Package routingstore provides a data store distributing uploads across
+// multiple data stores.
+//
+// When an upload is created, the first route whose predicate matches its
+// FileInfo decides which data store holds the upload, e.g. small profile
+// pictures may be kept on the local disk while large videos are sent to a
+// cloud storage. The route's name is encoded as prefix into the upload's ID,
+// so that subsequent requests for the upload are sent to the same data store
+// without consulting the predicates again:
+//
+//	<route name>-<ID assigned by the route's data store>
+//
+// The routes' data stores are described using StoreComposers, so that the
+// RoutingStore knows which extensions each of them supports. Only those
+// extensions which are supported by all routes are added to the composer in
+// UseIn. Locking is not covered and must be configured separately.
+//
+// A route may name another route as its fallback, which creates the uploads
+// while the route's data store is unavailable. These uploads are moved back
+// once they are finished, see RoutingStore.Migrate.
+package routingstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/pkg/handler"
+)
+
+// separator divides the route's name from the ID assigned by its data store.
+// It sorts before all characters allowed in names, so that the uploads of all
+// routes are ordered by their IDs if the routes are ordered by their names.
+const separator = "-"
+
+var reRouteName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+var (
+	// ErrNoRoute is returned when creating an upload which is not matched by any
+	// route.
+	ErrNoRoute = handler.NewHTTPError(errors.New("no data store accepts the upload"), http.StatusInternalServerError)
+	// ErrMixedRoutes is returned when concatenating partial uploads which are
+	// held by different data stores.
+	ErrMixedRoutes = handler.NewHTTPError(errors.New("partial uploads are held by different data stores"), http.StatusBadRequest)
+)
+
+// Route describes one of the data stores uploads are distributed across.
+type Route struct {
+	// Name identifies the route in upload IDs. It may only contain lowercase
+	// letters and digits and must not be changed once uploads have been
+	// created, since they could not be found anymore.
+	Name string
+	// Composer contains the route's data store and its extensions.
+	Composer *handler.StoreComposer
+	// Match decides whether a new upload is created by this route's data
+	// store. If it is nil, all uploads are matched, which can be used for a
+	// default route at the end.
+	Match func(info handler.FileInfo) bool
+	// Fallback is the name of the route which creates the uploads matched by
+	// this route while its data store is unavailable, as decided by
+	// IsUnavailable. The data store of the fallback route must support listing
+	// uploads and updating their metadata, so that they can be migrated.
+	// Uploads are not moved to the fallback once they have been created.
+	Fallback string
+	// IsUnavailable decides whether an error returned by the route's data store
+	// when creating an upload indicates that it is unavailable. Defaults to the
+	// package's IsUnavailable.
+	IsUnavailable func(err error) bool
+}
+
+// MinSize matches uploads whose length is known on creation and at least the
+// given number of bytes.
+func MinSize(size int64) func(info handler.FileInfo) bool {
+	return func(info handler.FileInfo) bool {
+		return !info.SizeIsDeferred && info.Size >= size
+	}
+}
+
+// MetaDataEquals matches uploads whose metadata contains the key with the
+// given value.
+func MetaDataEquals(key string, value string) func(info handler.FileInfo) bool {
+	return func(info handler.FileInfo) bool {
+		actual, ok := info.MetaData[key]
+		return ok && actual == value
+	}
+}
+
+// RoutingStore delegates to the data stores of its routes.
+type RoutingStore struct {
+	// routes are consulted in their order when creating uploads.
+	routes []*Route
+	byName map[string]*Route
+	// fallbacks contains the names of the routes which are the fallback of
+	// another route, so that their uploads may have been migrated.
+	fallbacks map[string]bool
+}
+
+// New creates a RoutingStore distributing uploads across the routes. The routes'
+// predicates are evaluated in the given order.
+func New(routes []Route) (RoutingStore, error) {
+	store := RoutingStore{
+		byName:    make(map[string]*Route, len(routes)),
+		fallbacks: make(map[string]bool),
+	}
+
+	if len(routes) == 0 {
+		return store, errors.New("routingstore: at least one route is required")
+	}
+
+	for i := range routes {
+		route := &routes[i]
+		if !reRouteName.MatchString(route.Name) {
+			return store, fmt.Errorf("routingstore: invalid route name %q", route.Name)
+		}
+		if _, ok := store.byName[route.Name]; ok {
+			return store, fmt.Errorf("routingstore: duplicate route name %q", route.Name)
+		}
+		if route.Composer == nil || route.Composer.Core == nil {
+			return store, fmt.Errorf("routingstore: route %q has no data store", route.Name)
+		}
+
+		store.routes = append(store.routes, route)
+		store.byName[route.Name] = route
+	}
+
+	for _, route := range store.routes {
+		if route.Fallback == "" {
+			continue
+		}
+
+		fallback, ok := store.byName[route.Fallback]
+		if !ok || fallback == route {
+			return store, fmt.Errorf("routingstore: invalid fallback %q for route %q", route.Fallback, route.Name)
+		}
+		if !fallback.Composer.UsesLister || !fallback.Composer.UsesMetaDataUpdater {
+			return store, fmt.Errorf("routingstore: data store of fallback %q cannot list uploads and update metadata", fallback.Name)
+		}
+		if route.IsUnavailable == nil {
+			route.IsUnavailable = IsUnavailable
+		}
+
+		store.fallbacks[fallback.Name] = true
+	}
+
+	return store, nil
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// the extensions which are supported by the data stores of all routes.
+func (store RoutingStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesTerminater }) {
+		composer.UseTerminater(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesConcater }) {
+		composer.UseConcater(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesLengthDeferrer }) {
+		composer.UseLengthDeferrer(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesExpirer }) {
+		composer.UseExpirer(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesTruncater }) {
+		composer.UseTruncater(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesHolder }) {
+		composer.UseHolder(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesLister }) {
+		composer.UseLister(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesMetaDataUpdater }) {
+		composer.UseMetaDataUpdater(store)
+	}
+	if store.all(func(c *handler.StoreComposer) bool { return c.UsesReleaser }) {
+		composer.UseReleaser(store)
+	}
+}
+
+// all checks whether the composers of all routes satisfy the condition.
+func (store RoutingStore) all(condition func(composer *handler.StoreComposer) bool) bool {
+	for _, route := range store.routes {
+		if !condition(route.Composer) {
+			return false
+		}
+	}
+	return true
+}
+
+func (store RoutingStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	route, err := store.matchRoute(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// The migration state must not be forged by clients
+	meta := make(handler.MetaData, len(info.MetaData)+1)
+	for key, value := range info.MetaData {
+		if key != MigrateToKey && key != MigratedToKey {
+			meta[key] = value
+		}
+	}
+	info.MetaData = meta
+
+	upload, err := route.Composer.Core.NewUpload(ctx, info)
+	if err != nil && route.Fallback != "" && route.IsUnavailable(err) {
+		info.MetaData[MigrateToKey] = route.Name
+		route = store.byName[route.Fallback]
+		upload, err = route.Composer.Core.NewUpload(ctx, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapUpload(route, upload, ""), nil
+}
+
+func (store RoutingStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	_, _, upload, err := store.resolve(ctx, id, true)
+	return upload, err
+}
+
+// resolve returns the route holding the upload's data and the ID assigned by
+// its data store. If the upload has been migrated, its new location is
+// returned. The upload is fetched if needed for resolving the ID or if
+// requested.
+func (store RoutingStore) resolve(ctx context.Context, id string, fetch bool) (*Route, string, handler.Upload, error) {
+	route, innerID, err := store.splitID(id)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if !fetch && !store.fallbacks[route.Name] {
+		return route, innerID, nil, nil
+	}
+
+	upload, err := route.Composer.Core.GetUpload(ctx, innerID)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	if !store.fallbacks[route.Name] {
+		return route, innerID, wrapUpload(route, upload, ""), nil
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	target, ok := info.MetaData[MigratedToKey]
+	if !ok {
+		return route, innerID, wrapUpload(route, upload, ""), nil
+	}
+
+	// The migrated upload keeps the ID known to clients
+	route, innerID, err = store.splitID(target)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	upload, err = route.Composer.Core.GetUpload(ctx, innerID)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return route, innerID, wrapUpload(route, upload, id), nil
+}
+
+// matchRoute returns the route creating the upload. Final uploads are created
+// by the route holding their partial uploads.
+func (store RoutingStore) matchRoute(info handler.FileInfo) (*Route, error) {
+	if info.IsFinal && len(info.PartialUploads) > 0 {
+		route, _, err := store.splitID(info.PartialUploads[0])
+		return route, err
+	}
+
+	for _, route := range store.routes {
+		if route.Match == nil || route.Match(info) {
+			return route, nil
+		}
+	}
+
+	return nil, ErrNoRoute
+}
+
+// splitID returns the route encoded in the upload's ID and the ID assigned by
+// its data store. IDs of unknown routes are reported as not found.
+func (store RoutingStore) splitID(id string) (*Route, string, error) {
+	index := strings.Index(id, separator)
+	if index == -1 {
+		return nil, "", handler.ErrNotFound
+	}
+
+	route, ok := store.byName[id[:index]]
+	if !ok {
+		return nil, "", handler.ErrNotFound
+	}
+
+	return route, id[index+len(separator):], nil
+}
+
+func (store RoutingStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	u := unwrapUpload(upload)
+	return u.route.Composer.Terminater.AsTerminatableUpload(u.Upload)
+}
+
+func (store RoutingStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	u := unwrapUpload(upload)
+	return &concatableUpload{
+		route:            u.route,
+		ConcatableUpload: u.route.Composer.Concater.AsConcatableUpload(u.Upload),
+	}
+}
+
+func (store RoutingStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	u := unwrapUpload(upload)
+	return u.route.Composer.LengthDeferrer.AsLengthDeclarableUpload(u.Upload)
+}
+
+func (store RoutingStore) AsExpirableUpload(upload handler.Upload) handler.ExpirableUpload {
+	u := unwrapUpload(upload)
+	return u.route.Composer.Expirer.AsExpirableUpload(u.Upload)
+}
+
+func (store RoutingStore) AsTruncatableUpload(upload handler.Upload) handler.TruncatableUpload {
+	u := unwrapUpload(upload)
+	return u.route.Composer.Truncater.AsTruncatableUpload(u.Upload)
+}
+
+func (store RoutingStore) AsHoldableUpload(upload handler.Upload) handler.HoldableUpload {
+	u := unwrapUpload(upload)
+	return u.route.Composer.Holder.AsHoldableUpload(u.Upload)
+}
+
+func (store RoutingStore) AsMetaDataUpdatableUpload(upload handler.Upload) handler.MetaDataUpdatableUpload {
+	u := unwrapUpload(upload)
+	return u.route.Composer.MetaDataUpdater.AsMetaDataUpdatableUpload(u.Upload)
+}
+
+func (store RoutingStore) WithholdUpload(ctx context.Context, id string) error {
+	route, innerID, _, err := store.resolve(ctx, id, false)
+	if err != nil {
+		return err
+	}
+
+	return route.Composer.Releaser.WithholdUpload(ctx, innerID)
+}
+
+func (store RoutingStore) ReleaseUpload(ctx context.Context, id string) error {
+	route, innerID, _, err := store.resolve(ctx, id, false)
+	if err != nil {
+		return err
+	}
+
+	return route.Composer.Releaser.ReleaseUpload(ctx, innerID)
+}
+
+// ListUploads lists the uploads of the routes in the order of their names,
+// which matches the order of the uploads' IDs. Migrated uploads are only
+// listed at their new location.
+func (store RoutingStore) ListUploads(ctx context.Context, after string, limit int) ([]handler.FileInfo, error) {
+	names := make([]string, 0, len(store.byName))
+	for name := range store.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make([]handler.FileInfo, 0, limit)
+	for _, name := range names {
+		prefix := name + separator
+
+		innerAfter := ""
+		if strings.HasPrefix(after, prefix) {
+			innerAfter = strings.TrimPrefix(after, prefix)
+		} else if after > prefix {
+			// All uploads of this route have already been listed
+			continue
+		}
+
+		lister := store.byName[name].Composer.Lister
+		for len(infos) < limit {
+			pageLimit := limit - len(infos)
+			routeInfos, err := lister.ListUploads(ctx, innerAfter, pageLimit)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, info := range routeInfos {
+				if _, ok := info.MetaData[MigratedToKey]; ok {
+					continue
+				}
+				info.ID = prefix + info.ID
+				infos = append(infos, info)
+			}
+
+			if len(routeInfos) < pageLimit {
+				break
+			}
+			innerAfter = routeInfos[len(routeInfos)-1].ID
+		}
+
+		if len(infos) == limit {
+			break
+		}
+	}
+
+	return infos, nil
+}
+
+// routedUpload is an upload held by the data store of a route. It reports the
+// upload's ID including the route's name.
+type routedUpload struct {
+	handler.Upload
+	route *Route
+	// id overrides the reported ID for migrated uploads, which keep the ID
+	// assigned when they were created by the fallback.
+	id string
+}
+
+// signableRoutedUpload is a routedUpload whose data store is able to sign URLs.
+type signableRoutedUpload struct {
+	*routedUpload
+	signable handler.SignableUpload
+}
+
+func (upload *signableRoutedUpload) SignURL(ctx context.Context, expiry time.Duration, contentType string, contentDisposition string) (string, error) {
+	return upload.signable.SignURL(ctx, expiry, contentType, contentDisposition)
+}
+
+// wrapUpload wraps the upload from the route's data store, preserving its
+// ability to sign URLs.
+func wrapUpload(route *Route, upload handler.Upload, id string) handler.Upload {
+	routed := &routedUpload{
+		Upload: upload,
+		route:  route,
+		id:     id,
+	}
+
+	if signable, ok := upload.(handler.SignableUpload); ok {
+		return &signableRoutedUpload{
+			routedUpload: routed,
+			signable:     signable,
+		}
+	}
+
+	return routed
+}
+
+func unwrapUpload(upload handler.Upload) *routedUpload {
+	if signable, ok := upload.(*signableRoutedUpload); ok {
+		return signable.routedUpload
+	}
+	return upload.(*routedUpload)
+}
+
+func (upload *routedUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.Upload.GetInfo(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	if upload.id != "" {
+		info.ID = upload.id
+	} else {
+		info.ID = upload.route.Name + separator + info.ID
+	}
+	return info, nil
+}
+
+// concatableUpload passes the partial uploads on to the route's data store,
+// which only knows its own uploads.
+type concatableUpload struct {
+	handler.ConcatableUpload
+	route *Route
+}
+
+func (upload *concatableUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	inner := make([]handler.Upload, len(partialUploads))
+	for i, partialUpload := range partialUploads {
+		routed := unwrapUpload(partialUpload)
+		if routed.route != upload.route {
+			return ErrMixedRoutes
+		}
+		inner[i] = routed.Upload
+	}
+
+	return upload.ConcatableUpload.ConcatUploads(ctx, inner)
+}
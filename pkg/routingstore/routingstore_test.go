@@ -0,0 +1,297 @@
+package routingstore
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/pkg/filestore"
+	"github.com/tus/tusd/pkg/handler"
+)
+
+// Test interface implementation of RoutingStore
+var _ handler.DataStore = RoutingStore{}
+var _ handler.TerminaterDataStore = RoutingStore{}
+var _ handler.ConcaterDataStore = RoutingStore{}
+var _ handler.LengthDeferrerDataStore = RoutingStore{}
+var _ handler.ExpirerDataStore = RoutingStore{}
+var _ handler.TruncaterDataStore = RoutingStore{}
+var _ handler.HolderDataStore = RoutingStore{}
+var _ handler.ListerDataStore = RoutingStore{}
+var _ handler.MetaDataUpdaterDataStore = RoutingStore{}
+var _ handler.ReleaserDataStore = RoutingStore{}
+
+// setup creates a RoutingStore sending uploads of at least 100 bytes and
+// videos to the "large" filestore and all others to the "small" one.
+func setup(t *testing.T) (store RoutingStore, smallDir string, largeDir string) {
+	a := assert.New(t)
+
+	smallDir, err := ioutil.TempDir("", "tusd-routingstore-small-")
+	a.NoError(err)
+	largeDir, err = ioutil.TempDir("", "tusd-routingstore-large-")
+	a.NoError(err)
+
+	small := handler.NewStoreComposer()
+	filestore.New(smallDir).UseIn(small)
+	large := handler.NewStoreComposer()
+	filestore.New(largeDir).UseIn(large)
+
+	store, err = New([]Route{
+		{
+			Name:     "large",
+			Composer: large,
+			Match: func(info handler.FileInfo) bool {
+				return MinSize(100)(info) || MetaDataEquals("filetype", "video/mp4")(info)
+			},
+		},
+		{
+			Name:     "small",
+			Composer: small,
+		},
+	})
+	a.NoError(err)
+
+	return store, smallDir, largeDir
+}
+
+func TestRoutes(t *testing.T) {
+	a := assert.New(t)
+
+	store, smallDir, largeDir := setup(t)
+	defer os.RemoveAll(smallDir)
+	defer os.RemoveAll(largeDir)
+
+	composer := handler.NewStoreComposer()
+	store.UseIn(composer)
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		StoreComposer: composer,
+		BasePath:      "/files/",
+	})
+	a.NoError(err)
+
+	server := httptest.NewServer(http.StripPrefix("/files/", tusHandler))
+	defer server.Close()
+
+	upload := func(content string, metadata string) string {
+		req, _ := http.NewRequest("POST", server.URL+"/files/", nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+		if metadata != "" {
+			req.Header.Set("Upload-Metadata", metadata)
+		}
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal(http.StatusCreated, res.StatusCode)
+		url := res.Header.Get("Location")
+
+		req, _ = http.NewRequest("PATCH", url, strings.NewReader(content))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		res, err = http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal(http.StatusNoContent, res.StatusCode)
+
+		return url
+	}
+
+	head := func(url string) *http.Response {
+		req, _ := http.NewRequest("HEAD", url, nil)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		res, err := http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		return res
+	}
+
+	small := upload("hello", "")
+	large := upload(strings.Repeat("a", 150), "")
+	// video/mp4
+	video := upload("world", "filetype dmlkZW8vbXA0")
+
+	for url, route := range map[string]string{
+		small: "small",
+		large: "large",
+		video: "large",
+	} {
+		id := strings.TrimPrefix(url, server.URL+"/files/")
+		a.True(strings.HasPrefix(id, route+"-"), id)
+
+		res := head(url)
+		a.Equal(http.StatusOK, res.StatusCode)
+		a.Equal(res.Header.Get("Upload-Length"), res.Header.Get("Upload-Offset"))
+
+		// The upload is stored in the route's directory under the inner ID
+		dir := smallDir
+		if route == "large" {
+			dir = largeDir
+		}
+		_, err := os.Stat(filepath.Join(dir, strings.TrimPrefix(id, route+"-")))
+		a.NoError(err)
+	}
+
+	res := head(strings.Replace(small, "small-", "large-", 1))
+	a.Equal(http.StatusNotFound, res.StatusCode)
+	res = head(strings.Replace(small, "small-", "other-", 1))
+	a.Equal(http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(large)
+	a.NoError(err)
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	a.NoError(err)
+	a.Equal(strings.Repeat("a", 150), string(content))
+}
+
+func TestCapabilities(t *testing.T) {
+	a := assert.New(t)
+
+	store, smallDir, largeDir := setup(t)
+	defer os.RemoveAll(smallDir)
+	defer os.RemoveAll(largeDir)
+
+	composer := handler.NewStoreComposer()
+	store.UseIn(composer)
+	a.True(composer.UsesTerminater)
+	a.True(composer.UsesConcater)
+	a.True(composer.UsesLister)
+	// The filestore does not support expiration
+	a.False(composer.UsesExpirer)
+
+	// A route with only a core data store removes all extensions
+	core := handler.NewStoreComposer()
+	core.UseCore(filestore.New(smallDir))
+	store, err := New([]Route{
+		{Name: "full", Composer: store.byName["small"].Composer, Match: MinSize(10)},
+		{Name: "core", Composer: core},
+	})
+	a.NoError(err)
+
+	composer = handler.NewStoreComposer()
+	store.UseIn(composer)
+	a.Equal(store, composer.Core)
+	a.False(composer.UsesTerminater)
+	a.False(composer.UsesConcater)
+	a.False(composer.UsesLengthDeferrer)
+	a.False(composer.UsesLister)
+}
+
+func TestListUploads(t *testing.T) {
+	a := assert.New(t)
+
+	store, smallDir, largeDir := setup(t)
+	defer os.RemoveAll(smallDir)
+	defer os.RemoveAll(largeDir)
+
+	ctx := context.Background()
+	var ids []string
+	for _, size := range []int64{1, 200, 2, 300, 3} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{Size: size})
+		a.NoError(err)
+		info, err := upload.GetInfo(ctx)
+		a.NoError(err)
+		ids = append(ids, info.ID)
+	}
+
+	var listed []string
+	after := ""
+	for {
+		infos, err := store.ListUploads(ctx, after, 2)
+		a.NoError(err)
+		for _, info := range infos {
+			listed = append(listed, info.ID)
+		}
+		if len(infos) < 2 {
+			break
+		}
+		after = infos[len(infos)-1].ID
+	}
+
+	// The uploads of the large route come first and all are ordered by ID
+	a.Len(listed, 5)
+	a.True(strings.HasPrefix(listed[0], "large-"))
+	a.True(strings.HasPrefix(listed[1], "large-"))
+	a.True(strings.HasPrefix(listed[2], "small-"))
+	a.ElementsMatch(ids, listed)
+	for i := 1; i < len(listed); i++ {
+		a.True(listed[i-1] < listed[i])
+	}
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+
+	store, smallDir, largeDir := setup(t)
+	defer os.RemoveAll(smallDir)
+	defer os.RemoveAll(largeDir)
+
+	ctx := context.Background()
+	create := func(content string, size int64) handler.Upload {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{Size: size, IsPartial: true})
+		a.NoError(err)
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+		a.NoError(err)
+		return upload
+	}
+
+	first := create("hello", 5)
+	second := create(" world", 6)
+	firstInfo, err := first.GetInfo(ctx)
+	a.NoError(err)
+	secondInfo, err := second.GetInfo(ctx)
+	a.NoError(err)
+
+	// The final upload is created next to its partial uploads, regardless of its size
+	final, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:           1000,
+		IsFinal:        true,
+		PartialUploads: []string{firstInfo.ID, secondInfo.ID},
+	})
+	a.NoError(err)
+	finalInfo, err := final.GetInfo(ctx)
+	a.NoError(err)
+	a.True(strings.HasPrefix(finalInfo.ID, "small-"))
+
+	a.NoError(store.AsConcatableUpload(final).ConcatUploads(ctx, []handler.Upload{first, second}))
+	content, err := ioutil.ReadFile(filepath.Join(smallDir, strings.TrimPrefix(finalInfo.ID, "small-")))
+	a.NoError(err)
+	a.Equal("hello world", string(content))
+
+	large := create(strings.Repeat("a", 100), 100)
+	a.Equal(ErrMixedRoutes, store.AsConcatableUpload(final).ConcatUploads(ctx, []handler.Upload{first, large}))
+}
+
+func TestNew(t *testing.T) {
+	a := assert.New(t)
+
+	composer := handler.NewStoreComposer()
+	composer.UseCore(filestore.New("."))
+
+	_, err := New(nil)
+	a.EqualError(err, "routingstore: at least one route is required")
+
+	_, err = New([]Route{{Name: "Invalid-Name", Composer: composer}})
+	a.EqualError(err, `routingstore: invalid route name "Invalid-Name"`)
+
+	_, err = New([]Route{{Name: "a", Composer: composer}, {Name: "a", Composer: composer}})
+	a.EqualError(err, `routingstore: duplicate route name "a"`)
+
+	_, err = New([]Route{{Name: "a", Composer: handler.NewStoreComposer()}})
+	a.EqualError(err, `routingstore: route "a" has no data store`)
+
+	// Uploads not matched by any route are rejected
+	store, err := New([]Route{{Name: "a", Composer: composer, Match: MinSize(10)}})
+	a.NoError(err)
+	_, err = store.NewUpload(context.Background(), handler.FileInfo{Size: 5})
+	a.Equal(ErrNoRoute, err)
+}